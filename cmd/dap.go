@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"interpreter/core"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// debug --dap speaks the Debug Adapter Protocol. The script runs on its
+// own goroutine, a pause hands the core.Paused state to the serving
+// goroutine and blocks until it is resumed, so only the serving
+// goroutine touches the paused interpreter. There is a single thread
+// and a single source, the launched program
+
+const DAP_THREAD = 1
+
+type DapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type DapServer struct {
+	conn    *RpcConn
+	sandbox bool
+	seqLock sync.Mutex
+	seq     int
+
+	script   *Script
+	program  []core.STATEMENT_NODE
+	noDebug  bool
+	debugger *core.Debugger
+
+	// the script is running, cancel stops it
+	running bool
+	cancel  context.CancelFunc
+	stops   chan *core.Paused
+	resume  chan struct{}
+	done    chan int
+	// the current pause, nil while running
+	paused *core.Paused
+	// values and scopes behind variablesReference numbers, reset on
+	// every pause
+	handles []interface{}
+}
+
+func NewDapServer(in io.Reader, out io.Writer, sandbox bool) *DapServer {
+	server := &DapServer{
+		conn:    NewRpcConn(in, out),
+		sandbox: sandbox,
+		stops:   make(chan *core.Paused),
+		resume:  make(chan struct{}),
+		done:    make(chan int, 1),
+	}
+	server.debugger = core.NewDebugger(server.Paused)
+	server.debugger.StopOnEntry(false)
+	return server
+}
+
+// called on the script goroutine, waits for the serving one to resume
+func (self *DapServer) Paused(paused *core.Paused) {
+	self.stops <- paused
+	<-self.resume
+}
+
+func (self *DapServer) send(message map[string]interface{}) {
+	self.seqLock.Lock()
+	self.seq++
+	message["seq"] = self.seq
+	self.seqLock.Unlock()
+	self.conn.Write(message)
+}
+
+func (self *DapServer) Event(event string, body interface{}) {
+	self.send(map[string]interface{}{"type": "event", "event": event, "body": body})
+}
+
+func (self *DapServer) Respond(request *DapRequest, body interface{}, err error) {
+	response := map[string]interface{}{
+		"type":        "response",
+		"request_seq": request.Seq,
+		"command":     request.Command,
+		"success":     err == nil,
+	}
+	if err != nil {
+		response["message"] = err.Error()
+	} else if body != nil {
+		response["body"] = body
+	}
+	self.send(response)
+}
+
+// serves until disconnect or the end of input, the exit code is the
+// script's
+func (self *DapServer) Serve() int {
+	requests := make(chan *DapRequest)
+	go func() {
+		defer close(requests)
+		for {
+			body, err := self.conn.ReadBody()
+			if err != nil {
+				return
+			}
+			request := &DapRequest{}
+			if err := json.Unmarshal(body, request); err == nil {
+				requests <- request
+			}
+		}
+	}()
+
+	code := EXIT_OK
+	for {
+		select {
+		case request, ok := <-requests:
+			if !ok {
+				self.stop()
+				return code
+			}
+			if request.Command == "disconnect" || request.Command == "terminate" {
+				self.stop()
+				self.Respond(request, nil, nil)
+				if request.Command == "disconnect" {
+					return code
+				}
+				continue
+			}
+			body, err := self.Handle(request)
+			self.Respond(request, body, err)
+			if request.Command == "launch" && err == nil {
+				// breakpoints can be set now that the program is known
+				self.Event("initialized", nil)
+			}
+		case paused := <-self.stops:
+			self.paused, self.handles = paused, nil
+			ids := []int{}
+			for _, breakpoint := range paused.Breakpoints {
+				ids = append(ids, breakpoint.ID)
+			}
+			self.Event("stopped", map[string]interface{}{
+				"reason":            paused.Reason,
+				"threadId":          DAP_THREAD,
+				"allThreadsStopped": true,
+				"hitBreakpointIds":  ids,
+			})
+		case code = <-self.done:
+			self.running = false
+			self.Event("exited", map[string]int{"exitCode": code})
+			self.Event("terminated", nil)
+		}
+	}
+}
+
+// stops a running script and waits for it to end
+func (self *DapServer) stop() {
+	if !self.running {
+		return
+	}
+	self.cancel()
+	for self.running {
+		if self.paused != nil {
+			self.paused.Terminate()
+			self.Resume()
+		}
+		select {
+		case self.paused = <-self.stops:
+		case <-self.done:
+			self.running = false
+		}
+	}
+}
+
+func (self *DapServer) Resume() {
+	self.paused, self.handles = nil, nil
+	self.resume <- struct{}{}
+}
+
+func (self *DapServer) Handle(request *DapRequest) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args struct {
+			Program     string   `json:"program"`
+			Args        []string `json:"args"`
+			StopOnEntry bool     `json:"stopOnEntry"`
+			NoDebug     bool     `json:"noDebug"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		if args.Program == "" {
+			return nil, errors.New("launch needs a program")
+		}
+		source, err := ReadSource(args.Program)
+		if err != nil {
+			return nil, err
+		}
+		if args.Args == nil {
+			args.Args = []string{}
+		}
+		self.script = &Script{args.Program, source, args.Args}
+		self.program, err = self.script.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(err.Error()))
+		}
+		self.noDebug = args.NoDebug
+		self.debugger.StopOnEntry(args.StopOnEntry)
+		return nil, nil
+	case "setBreakpoints":
+		var args struct {
+			Breakpoints []struct {
+				Line      int    `json:"line"`
+				Condition string `json:"condition"`
+			} `json:"breakpoints"`
+		}
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+		breakable := core.BreakableLines(self.program)
+		self.debugger.ClearBreakpoints(0)
+		result := []map[string]interface{}{}
+		for _, requested := range args.Breakpoints {
+			breakpoint, err := self.debugger.SetBreakpoint(requested.Line, requested.Condition)
+			if err != nil {
+				result = append(result, map[string]interface{}{
+					"verified": false, "line": requested.Line, "message": err.Error(),
+				})
+				continue
+			}
+			entry := map[string]interface{}{
+				"id": breakpoint.ID, "verified": breakable[requested.Line], "line": requested.Line,
+			}
+			if !breakable[requested.Line] {
+				entry["message"] = "no statement starts on this line"
+			}
+			result = append(result, entry)
+		}
+		return map[string]interface{}{"breakpoints": result}, nil
+	case "setExceptionBreakpoints":
+		return map[string]interface{}{"breakpoints": []interface{}{}}, nil
+	case "configurationDone":
+		if self.script == nil {
+			return nil, errors.New("no program was launched")
+		}
+		self.Start()
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": DAP_THREAD, "name": "main"}},
+		}, nil
+	case "pause":
+		self.debugger.Pause()
+		return nil, nil
+	}
+
+	if self.paused == nil {
+		return nil, fmt.Errorf("%s needs a paused script", request.Command)
+	}
+	return self.HandlePaused(request)
+}
+
+// runs the script on its own goroutine
+func (self *DapServer) Start() {
+	interpreter := self.script.NewInterpreter(self.sandbox)
+	interpreter.SetStdin(strings.NewReader(""))
+	interpreter.SetStdout(&DapOutput{self, "stdout"})
+	interpreter.SetStderr(&DapOutput{self, "stderr"})
+	if !self.noDebug {
+		interpreter.SetDebugger(self.debugger)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	self.cancel, self.running = cancel, true
+	go func() {
+		err := interpreter.Interpret(ctx, self.program)
+		var exitErr *core.ExitError
+		if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, core.ErrCancelled) {
+			var report strings.Builder
+			ReportError(&report, err, self.script.File, self.script.Source)
+			self.Event("output", map[string]string{"category": "stderr", "output": report.String()})
+		}
+		self.done <- ExitCode(err)
+	}()
+}
+
+// sends what the script writes as output events
+type DapOutput struct {
+	server   *DapServer
+	category string
+}
+
+func (self *DapOutput) Write(data []byte) (int, error) {
+	self.server.Event("output", map[string]string{"category": self.category, "output": string(data)})
+	return len(data), nil
+}
+
+func (self *DapServer) HandlePaused(request *DapRequest) (interface{}, error) {
+	var args struct {
+		FrameID            int    `json:"frameId"`
+		VariablesReference int    `json:"variablesReference"`
+		Expression         string `json:"expression"`
+	}
+	if len(request.Arguments) > 0 {
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+	}
+	frames := self.paused.Frames()
+
+	switch request.Command {
+	case "continue":
+		self.paused.Continue()
+		self.Resume()
+		return map[string]bool{"allThreadsContinued": true}, nil
+	case "next":
+		self.paused.StepOver()
+		self.Resume()
+		return nil, nil
+	case "stepIn":
+		self.paused.StepIn()
+		self.Resume()
+		return nil, nil
+	case "stepOut":
+		self.paused.StepOut()
+		self.Resume()
+		return nil, nil
+	case "stackTrace":
+		source := map[string]string{"name": filepath.Base(self.script.File), "path": self.script.File}
+		result := []map[string]interface{}{}
+		for i, frame := range frames {
+			result = append(result, map[string]interface{}{
+				"id":     i,
+				"name":   frame.Function,
+				"line":   frame.Position.Line,
+				"column": frame.Position.Column,
+				"source": source,
+			})
+		}
+		return map[string]interface{}{"stackFrames": result, "totalFrames": len(result)}, nil
+	case "scopes":
+		if args.FrameID < 0 || args.FrameID >= len(frames) {
+			return nil, fmt.Errorf("no frame %d", args.FrameID)
+		}
+		result := []map[string]interface{}{}
+		for _, scope := range self.paused.Scopes(frames[args.FrameID]) {
+			result = append(result, map[string]interface{}{
+				"name":               strings.ToUpper(scope.Name[:1]) + scope.Name[1:],
+				"variablesReference": self.NewHandle(scope),
+				"namedVariables":     len(scope.Variables),
+				"expensive":          false,
+			})
+		}
+		return map[string]interface{}{"scopes": result}, nil
+	case "variables":
+		index := args.VariablesReference - 1
+		if index < 0 || index >= len(self.handles) {
+			return nil, fmt.Errorf("no variables %d", args.VariablesReference)
+		}
+		return map[string]interface{}{"variables": self.Variables(self.handles[index])}, nil
+	case "evaluate":
+		value, err := self.paused.Eval(args.FrameID, args.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimSpace(err.Error()))
+		}
+		return map[string]interface{}{
+			"result":             Repr(value),
+			"type":               value.Typeof().FormatObjectType(),
+			"variablesReference": self.ValueHandle(value),
+		}, nil
+	}
+	return nil, fmt.Errorf("%s is not supported", request.Command)
+}
+
+// a variablesReference for value
+func (self *DapServer) NewHandle(value interface{}) int {
+	self.handles = append(self.handles, value)
+	return len(self.handles)
+}
+
+// arrays and maps can be expanded, other values have no handle
+func (self *DapServer) ValueHandle(value core.Object) int {
+	switch t := value.(type) {
+	case core.ARRAY:
+		if len(t) > 0 {
+			return self.NewHandle(t)
+		}
+	case core.MAP:
+		if len(t) > 0 {
+			return self.NewHandle(t)
+		}
+	}
+	return 0
+}
+
+func (self *DapServer) Variables(container interface{}) []map[string]interface{} {
+	names, values := []string{}, map[string]core.Object{}
+	switch t := container.(type) {
+	case core.ScopeVariables:
+		values = t.Variables
+	case core.MAP:
+		values = t
+	case core.ARRAY:
+		for i, value := range t {
+			names = append(names, strconv.Itoa(i))
+			values[strconv.Itoa(i)] = value
+		}
+	}
+	if len(names) == 0 {
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	variables := []map[string]interface{}{}
+	for _, name := range names {
+		value := values[name]
+		variables = append(variables, map[string]interface{}{
+			"name":               name,
+			"value":              Repr(value),
+			"type":               value.Typeof().FormatObjectType(),
+			"variablesReference": self.ValueHandle(value),
+		})
+	}
+	return variables
+}
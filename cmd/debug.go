@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DEBUG_PROMPT = "(debug) "
+
+const DEBUG_HELP = `an empty line repeats the last command
+  break line [if cond]  b   pause before line, or only when cond is true
+  delete [id]               remove a breakpoint, all without id
+  breakpoints               list breakpoints
+  continue              c   run until the next breakpoint
+  step                  s   run to the next statement, into calls
+  next                  n   run to the next statement, over calls
+  finish                    run until the current call returns
+  print expr            p   evaluate expr, or any code, in the selected frame
+  locals                    variables of the selected frame's scopes
+  backtrace             bt  the call stack
+  frame n               f   select frame n of the call stack
+  list [line]           l   source around the current or given line
+  quit                  q   stop the script
+`
+
+// lines of source shown by list
+const LIST_LINES = 5
+
+// CliDebugger is the handler of a core.Debugger reading commands from
+// the terminal
+type CliDebugger struct {
+	editor   *LineEditor
+	script   *Script
+	lines    []string
+	debugger *core.Debugger
+	// lines with a statement, see core.BreakableLines
+	breakable map[int]bool
+	// frame the commands apply to, 0 is the innermost
+	frame int
+	last  string
+}
+
+func DebugCommand(args []string) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	dap := flags.Bool("dap", false, "speak the Debug Adapter Protocol on stdin and stdout")
+	sandbox := flags.Bool("sandbox", false, "deny the fs, env and process builtins")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if *dap {
+		return NewDapServer(os.Stdin, os.Stdout, *sandbox).Serve()
+	}
+	if flags.NArg() == 0 {
+		return UsageError("debug needs a script")
+	}
+	if flags.Arg(0) == "-" {
+		return UsageError("debug reads commands from stdin, the script must be a file")
+	}
+
+	script, err := LoadScript(nil, false, flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return EXIT_USAGE
+	}
+	program, err := script.Parse()
+	if err != nil {
+		ReportError(os.Stderr, err, script.File, script.Source)
+		return EXIT_SYNTAX_ERROR
+	}
+
+	cli := &CliDebugger{
+		editor:    NewLineEditor(""),
+		script:    script,
+		lines:     strings.Split(script.Source, "\n"),
+		breakable: core.BreakableLines(program),
+	}
+	cli.debugger = core.NewDebugger(cli.Paused)
+	interpreter := script.NewInterpreter(*sandbox)
+	interpreter.SetStdin(cli.editor.Reader())
+	interpreter.SetDebugger(cli.debugger)
+
+	// Ctrl-C pauses the script instead of stopping it
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			cli.debugger.Pause()
+		}
+	}()
+
+	err = interpreter.Interpret(context.Background(), program)
+	var exitErr *core.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.Is(err, core.ErrCancelled) {
+		ReportError(os.Stderr, err, script.File, script.Source)
+	}
+	code := ExitCode(err)
+	fmt.Printf("script exited with %d\n", code)
+	return code
+}
+
+// reads and runs commands until one resumes the script
+func (self *CliDebugger) Paused(paused *core.Paused) {
+	self.frame = 0
+	position := paused.Statement.GetPosition()
+	switch paused.Reason {
+	case core.BREAKPOINT_REASON:
+		ids := []string{}
+		for _, breakpoint := range paused.Breakpoints {
+			ids = append(ids, strconv.Itoa(breakpoint.ID))
+		}
+		fmt.Printf("breakpoint %s at %s:%d\n", strings.Join(ids, ", "), self.script.File, position.Line)
+	default:
+		fmt.Printf("paused (%s) at %s:%d\n", paused.Reason, self.script.File, position.Line)
+	}
+	self.showLine(position.Line, true)
+
+	for {
+		input, err := self.editor.ReadLine(DEBUG_PROMPT)
+		if err == ErrInterrupted {
+			continue
+		}
+		if err != nil {
+			// the end of input stops the script
+			paused.Terminate()
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			input = self.last
+		}
+		self.editor.AddHistory(input)
+		self.last = input
+		if resume := self.Command(paused, input); resume {
+			return
+		}
+	}
+}
+
+// runs a command, the result tells if the script goes on
+func (self *CliDebugger) Command(paused *core.Paused, input string) bool {
+	name, arg := input, ""
+	if i := strings.IndexAny(input, " \t"); i >= 0 {
+		name, arg = input[:i], strings.TrimSpace(input[i+1:])
+	}
+	switch name {
+	case "":
+	case "c", "continue":
+		paused.Continue()
+		return true
+	case "s", "step":
+		paused.StepIn()
+		return true
+	case "n", "next":
+		paused.StepOver()
+		return true
+	case "finish", "out":
+		paused.StepOut()
+		return true
+	case "q", "quit":
+		paused.Terminate()
+		return true
+	case "b", "break":
+		self.Break(arg)
+	case "delete":
+		id := 0
+		if arg != "" {
+			var err error
+			if id, err = strconv.Atoi(arg); err != nil {
+				fmt.Fprintf(os.Stderr, "usage: delete [id]\n")
+				break
+			}
+		}
+		if !self.debugger.ClearBreakpoints(id) && id != 0 {
+			fmt.Fprintf(os.Stderr, "no breakpoint %d\n", id)
+		}
+	case "breakpoints", "info":
+		for _, breakpoint := range self.debugger.Breakpoints() {
+			fmt.Printf("%d\tline %d", breakpoint.ID, breakpoint.Line)
+			if breakpoint.Condition != "" {
+				fmt.Printf(" if %s", breakpoint.Condition)
+			}
+			fmt.Printf("\thit %d times\n", breakpoint.Hits)
+		}
+	case "p", "print":
+		value, err := paused.Eval(self.frame, arg)
+		if err != nil {
+			ReportError(os.Stderr, err, "<print>", arg)
+			break
+		}
+		fmt.Println(Repr(value))
+	case "locals":
+		frame := paused.Frames()[self.frame]
+		for _, scope := range paused.Scopes(frame) {
+			if len(scope.Variables) == 0 {
+				continue
+			}
+			fmt.Printf("%s:\n", scope.Name)
+			names := []string{}
+			for name := range scope.Variables {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				fmt.Printf("  %s = %s\n", name, Repr(scope.Variables[name]))
+			}
+		}
+	case "bt", "backtrace", "where":
+		for i, frame := range paused.Frames() {
+			marker := " "
+			if i == self.frame {
+				marker = "*"
+			}
+			fmt.Printf("%s #%d %s at %s:%d\n", marker, i, frame.Function, self.script.File, frame.Position.Line)
+		}
+	case "f", "frame":
+		frames := paused.Frames()
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 || n >= len(frames) {
+			fmt.Fprintf(os.Stderr, "usage: frame n, with n from 0 to %d\n", len(frames)-1)
+			break
+		}
+		self.frame = n
+		fmt.Printf("#%d %s at %s:%d\n", n, frames[n].Function, self.script.File, frames[n].Position.Line)
+		self.showLine(frames[n].Position.Line, true)
+	case "l", "list":
+		line := paused.Frames()[self.frame].Position.Line
+		if arg != "" {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "usage: list [line]")
+				break
+			}
+			line = n
+		}
+		for n := line - LIST_LINES; n <= line+LIST_LINES; n++ {
+			self.showLine(n, n == paused.Frames()[self.frame].Position.Line)
+		}
+	case "h", "help":
+		fmt.Print(DEBUG_HELP)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s, type help for help\n", name)
+	}
+	return false
+}
+
+// "break line [if cond]"
+func (self *CliDebugger) Break(arg string) {
+	lineArg, condition := arg, ""
+	if i := strings.Index(arg, " if "); i >= 0 {
+		lineArg, condition = strings.TrimSpace(arg[:i]), strings.TrimSpace(arg[i+4:])
+	}
+	line, err := strconv.Atoi(lineArg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "usage: break line [if cond]")
+		return
+	}
+	breakpoint, err := self.debugger.SetBreakpoint(line, condition)
+	if err != nil {
+		ReportError(os.Stderr, err, "<condition>", condition)
+		return
+	}
+	fmt.Printf("breakpoint %d at %s:%d\n", breakpoint.ID, self.script.File, line)
+	if !self.breakable[line] {
+		fmt.Printf("no statement starts on line %d, it will not be hit\n", line)
+	}
+}
+
+func (self *CliDebugger) showLine(line int, current bool) {
+	if line < 1 || line > len(self.lines) {
+		return
+	}
+	marker := " "
+	if current {
+		marker = ">"
+	}
+	fmt.Printf("%s %4d | %s\n", marker, line, self.lines[line-1])
+}
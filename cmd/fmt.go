@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"os"
+)
+
+// fmt prints the formatted files, --write rewrites them instead and
+// --check only lists the ones that are not formatted. Without files
+// it formats stdin
+func FmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	check := flags.Bool("check", false, "list files that are not formatted, exit with 1 if any")
+	write := flags.Bool("write", false, "rewrite files that are not formatted")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if *check && *write {
+		return UsageError("--check and --write exclude each other")
+	}
+	files := flags.Args()
+	if len(files) == 0 {
+		if *write {
+			return UsageError("--write needs files")
+		}
+		files = []string{"-"}
+	}
+
+	code := EXIT_OK
+	for _, path := range files {
+		source, err := ReadSource(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			code = EXIT_USAGE
+			continue
+		}
+		name := path
+		if path == "-" {
+			name = "<stdin>"
+		}
+		formatted, err := core.Format(source)
+		if err != nil {
+			ReportError(os.Stderr, err, name, source)
+			code = EXIT_SYNTAX_ERROR
+			continue
+		}
+		switch {
+		case *check:
+			if formatted != source {
+				fmt.Println(name)
+				if code == EXIT_OK {
+					code = EXIT_RUNTIME_ERROR
+				}
+			}
+		case *write:
+			if formatted == source {
+				continue
+			}
+			info, err := os.Stat(path)
+			if err == nil {
+				err = os.WriteFile(path, []byte(formatted), info.Mode())
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %s\n", err)
+				code = EXIT_USAGE
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	return code
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON-RPC 2.0 with the Content-Length framing of LSP, the framing is
+// shared with DAP
+
+// error codes of JSON-RPC and LSP
+const (
+	PARSE_ERROR_RPC      = -32700
+	INVALID_REQUEST_RPC  = -32600
+	METHOD_NOT_FOUND_RPC = -32601
+	INVALID_PARAMS_RPC   = -32602
+	REQUEST_FAILED_RPC   = -32803
+)
+
+// a request or notification, requests have an ID
+type RpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type RpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (self *RpcError) Error() string {
+	return self.Message
+}
+
+func NewRpcError(code int, format string, args ...interface{}) *RpcError {
+	return &RpcError{code, fmt.Sprintf(format, args...)}
+}
+
+type RpcConn struct {
+	in *bufio.Reader
+	// messages are written whole, also from more than one goroutine
+	lock sync.Mutex
+	out  io.Writer
+}
+
+func NewRpcConn(in io.Reader, out io.Writer) *RpcConn {
+	return &RpcConn{in: bufio.NewReader(in), out: out}
+}
+
+// reads the next message, io.EOF when the input ends between messages
+func (self *RpcConn) Read() (*RpcMessage, error) {
+	body, err := self.ReadBody()
+	if err != nil {
+		return nil, err
+	}
+	message := &RpcMessage{}
+	if err := json.Unmarshal(body, message); err != nil {
+		return nil, NewRpcError(PARSE_ERROR_RPC, "invalid message: %s", err)
+	}
+	return message, nil
+}
+
+// reads the content of the next message
+func (self *RpcConn) ReadBody() ([]byte, error) {
+	headers, err := textproto.NewReader(self.in).ReadMIMEHeader()
+	if err == io.EOF && len(headers) == 0 {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", headers.Get("Content-Length"))
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(self.in, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// writes value as one message
+func (self *RpcConn) Write(value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	_, err = fmt.Fprintf(self.out, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (self *RpcConn) Notify(method string, params interface{}) error {
+	return self.Write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// answers the request with id, a result or an *RpcError
+func (self *RpcConn) Reply(id *json.RawMessage, result interface{}, err error) error {
+	response := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		rpcErr, ok := err.(*RpcError)
+		if !ok {
+			rpcErr = NewRpcError(REQUEST_FAILED_RPC, "%s", err)
+		}
+		response["error"] = rpcErr
+	} else {
+		response["result"] = result
+	}
+	return self.Write(response)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// history entries kept in the history file
+const MAX_HISTORY = 1000
+
+// ErrInterrupted is returned by ReadLine when Ctrl-C is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// LineEditor reads lines from a terminal with cursor movement and
+// history. The terminal is switched to raw mode with stty only while a
+// line is read. Without a terminal it reads plain lines
+type LineEditor struct {
+	in          *bufio.Reader
+	out         io.Writer
+	terminal    bool
+	history     []string
+	historyFile string
+}
+
+func NewLineEditor(historyFile string) *LineEditor {
+	editor := &LineEditor{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		terminal:    IsTerminal(os.Stdin) && IsTerminal(os.Stdout),
+		historyFile: historyFile,
+	}
+	editor.LoadHistory()
+	return editor
+}
+
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// the buffered stdin, scripts reading input must share it
+func (self *LineEditor) Reader() *bufio.Reader {
+	return self.in
+}
+
+func (self *LineEditor) LoadHistory() {
+	if self.historyFile == "" {
+		return
+	}
+	data, err := os.ReadFile(self.historyFile)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			self.history = append(self.history, UnescapeHistory(line))
+		}
+	}
+}
+
+// adds line to the history as it is and rewrites the history file
+func (self *LineEditor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" || (len(self.history) > 0 && self.history[len(self.history)-1] == line) {
+		return
+	}
+	self.history = append(self.history, line)
+	if len(self.history) > MAX_HISTORY {
+		self.history = self.history[len(self.history)-MAX_HISTORY:]
+	}
+	if self.historyFile == "" {
+		return
+	}
+	var data strings.Builder
+	for _, entry := range self.history {
+		data.WriteString(EscapeHistory(entry) + "\n")
+	}
+	os.WriteFile(self.historyFile, []byte(data.String()), 0600)
+}
+
+// the history file has an entry per line, so multi-line entries are
+// written with their line breaks as "\n" or "\r" and backslashes as "\\"
+func EscapeHistory(entry string) string {
+	entry = strings.ReplaceAll(entry, "\\", "\\\\")
+	entry = strings.ReplaceAll(entry, "\r", "\\r")
+	return strings.ReplaceAll(entry, "\n", "\\n")
+}
+
+func UnescapeHistory(line string) string {
+	var entry strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case !escaped && r == '\\':
+			escaped = true
+			continue
+		case escaped && r == 'n':
+			entry.WriteRune('\n')
+		case escaped && r == 'r':
+			entry.WriteRune('\r')
+		default:
+			entry.WriteRune(r)
+		}
+		escaped = false
+	}
+	return entry.String()
+}
+
+// reads a line without the line break, io.EOF at the end of input
+// or on Ctrl-D in an empty line
+func (self *LineEditor) ReadLine(prompt string) (string, error) {
+	if !self.terminal {
+		return self.readPlainLine()
+	}
+	state, err := sttyState()
+	if err != nil {
+		self.terminal = false
+		fmt.Fprint(self.out, prompt)
+		return self.readPlainLine()
+	}
+	if err := stty("raw", "-echo"); err != nil {
+		fmt.Fprint(self.out, prompt)
+		return self.readPlainLine()
+	}
+	defer stty(state)
+	return self.edit(prompt)
+}
+
+func (self *LineEditor) readPlainLine() (string, error) {
+	line, err := self.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), err
+}
+
+func sttyState() (string, error) {
+	command := exec.Command("stty", "-g")
+	command.Stdin = os.Stdin
+	state, err := command.Output()
+	return strings.TrimSpace(string(state)), err
+}
+
+func stty(args ...string) error {
+	command := exec.Command("stty", args...)
+	command.Stdin = os.Stdin
+	return command.Run()
+}
+
+// the line being edited, pos is the cursor index in line
+type editState struct {
+	prompt string
+	line   []rune
+	pos    int
+}
+
+func (self *LineEditor) edit(prompt string) (string, error) {
+	state := &editState{prompt: prompt}
+	// index in history while browsing it, the edited line is kept aside
+	historyPos, saved := len(self.history), ""
+	self.redraw(state)
+
+	for {
+		r, _, err := self.in.ReadRune()
+		if err != nil {
+			fmt.Fprint(self.out, "\r\n")
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(self.out, "\r\n")
+			return string(state.line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(self.out, "^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(state.line) == 0 {
+				fmt.Fprint(self.out, "\r\n")
+				return "", io.EOF
+			}
+			state.deleteAt(state.pos)
+		case 127, 8: // backspace
+			if state.pos > 0 {
+				state.pos--
+				state.deleteAt(state.pos)
+			}
+		case 1: // Ctrl-A
+			state.pos = 0
+		case 5: // Ctrl-E
+			state.pos = len(state.line)
+		case 2: // Ctrl-B
+			state.move(-1)
+		case 6: // Ctrl-F
+			state.move(1)
+		case 11: // Ctrl-K
+			state.line = state.line[:state.pos]
+		case 21: // Ctrl-U
+			state.line = state.line[state.pos:]
+			state.pos = 0
+		case 23: // Ctrl-W
+			start := state.pos
+			for start > 0 && state.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && state.line[start-1] != ' ' {
+				start--
+			}
+			state.line = append(state.line[:start], state.line[state.pos:]...)
+			state.pos = start
+		case 12: // Ctrl-L
+			fmt.Fprint(self.out, "\x1b[H\x1b[2J")
+		case 27: // escape sequence
+			switch self.readEscape() {
+			case "[A", "OA": // up
+				if historyPos > 0 {
+					if historyPos == len(self.history) {
+						saved = string(state.line)
+					}
+					historyPos--
+					state.set(self.history[historyPos])
+				}
+			case "[B", "OB": // down
+				if historyPos < len(self.history) {
+					historyPos++
+					if historyPos == len(self.history) {
+						state.set(saved)
+					} else {
+						state.set(self.history[historyPos])
+					}
+				}
+			case "[C", "OC":
+				state.move(1)
+			case "[D", "OD":
+				state.move(-1)
+			case "[H", "OH", "[1~":
+				state.pos = 0
+			case "[F", "OF", "[4~":
+				state.pos = len(state.line)
+			case "[3~": // delete
+				state.deleteAt(state.pos)
+			}
+		case '\t':
+			state.insert([]rune("    "))
+		default:
+			if unicode.IsPrint(r) {
+				state.insert([]rune{r})
+			}
+		}
+		self.redraw(state)
+	}
+}
+
+// reads the rest of an escape sequence, e.g. "[A" for the up arrow
+func (self *LineEditor) readEscape() string {
+	first, _, err := self.in.ReadRune()
+	if err != nil || (first != '[' && first != 'O') {
+		return ""
+	}
+	sequence := []rune{first}
+	for {
+		r, _, err := self.in.ReadRune()
+		if err != nil {
+			return ""
+		}
+		sequence = append(sequence, r)
+		// parameters are digits and ";", the final character ends it
+		if !unicode.IsDigit(r) && r != ';' {
+			return string(sequence)
+		}
+	}
+}
+
+// shown for the line breaks of a multi-line history entry, which is
+// edited on one line
+const LINE_BREAK_MARK = "↵"
+
+func (self *LineEditor) redraw(state *editState) {
+	line := strings.ReplaceAll(string(state.line), "\n", LINE_BREAK_MARK)
+	fmt.Fprintf(self.out, "\r%s%s\x1b[K", state.prompt, line)
+	if back := len(state.line) - state.pos; back > 0 {
+		fmt.Fprintf(self.out, "\x1b[%dD", back)
+	}
+}
+
+func (self *editState) insert(runes []rune) {
+	line := make([]rune, 0, len(self.line)+len(runes))
+	line = append(line, self.line[:self.pos]...)
+	line = append(line, runes...)
+	self.line = append(line, self.line[self.pos:]...)
+	self.pos += len(runes)
+}
+
+func (self *editState) deleteAt(pos int) {
+	if pos < len(self.line) {
+		self.line = append(self.line[:pos], self.line[pos+1:]...)
+	}
+}
+
+func (self *editState) move(offset int) {
+	if pos := self.pos + offset; pos >= 0 && pos <= len(self.line) {
+		self.pos = pos
+	}
+}
+
+func (self *editState) set(line string) {
+	self.line = []rune(line)
+	self.pos = len(self.line)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"os"
+	"sort"
+	"strings"
+)
+
+// a finding as printed by lint --format json
+type LintFinding struct {
+	File      string        `json:"file"`
+	Line      int           `json:"line"`
+	Column    int           `json:"column"`
+	EndLine   int           `json:"endLine"`
+	EndColumn int           `json:"endColumn"`
+	Rule      string        `json:"rule"`
+	Severity  core.Severity `json:"severity"`
+	Message   string        `json:"message"`
+}
+
+// lint reports the findings of core.Lint, exits with 1 if there are any
+// and with 2 if a file does not parse. --config reads a JSON
+// core.LintConfig, --enable and --disable override its rules
+func LintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	configFile := flags.String("config", "", "read rules and globals from a JSON file")
+	enable := flags.String("enable", "", "comma separated rules to turn on")
+	disable := flags.String("disable", "", "comma separated rules to turn off")
+	format := flags.String("format", "text", "output format, text or json")
+	list := flags.Bool("rules", false, "list the rules and exit")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if *list {
+		for _, rule := range core.LINT_RULES {
+			fmt.Printf("%-24s %s\n", rule, core.RuleSeverity(rule))
+		}
+		return EXIT_OK
+	}
+	if *format != "text" && *format != "json" {
+		return UsageError("unknown format %s", *format)
+	}
+
+	config := core.DefaultLintConfig()
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err == nil {
+			err = json.Unmarshal(data, &config)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s: %s\n", *configFile, err)
+			return EXIT_USAGE
+		}
+		if config.Rules == nil {
+			config.Rules = make(map[string]bool)
+		}
+		names := []string{}
+		for rule := range config.Rules {
+			names = append(names, rule)
+		}
+		sort.Strings(names)
+		for _, rule := range names {
+			if !IsLintRule(rule) {
+				return UsageError("unknown rule %s in %s, lint --rules lists them", rule, *configFile)
+			}
+		}
+	}
+	// scripts run by the cli always have args
+	config.Globals = append(config.Globals, "args")
+	for _, rules := range []struct {
+		names   string
+		enabled bool
+	}{{*enable, true}, {*disable, false}} {
+		for _, rule := range strings.Split(rules.names, ",") {
+			if rule = strings.TrimSpace(rule); rule == "" {
+				continue
+			}
+			if !IsLintRule(rule) {
+				return UsageError("unknown rule %s, lint --rules lists them", rule)
+			}
+			config.Rules[rule] = rules.enabled
+		}
+	}
+
+	files := flags.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	code := EXIT_OK
+	findings := []LintFinding{}
+	for _, path := range files {
+		source, err := ReadSource(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			code = EXIT_USAGE
+			continue
+		}
+		name := path
+		if path == "-" {
+			name = "<stdin>"
+		}
+		parser := core.NewParser(source)
+		parser.SetFile(name)
+		program, err := parser.ParseProgram()
+		if err != nil {
+			ReportError(os.Stderr, err, name, source)
+			code = EXIT_SYNTAX_ERROR
+			continue
+		}
+		for _, issue := range core.Lint(program, config) {
+			findings = append(findings, LintFinding{
+				File:      name,
+				Line:      issue.Start.Line,
+				Column:    issue.Start.Column,
+				EndLine:   issue.End.Line,
+				EndColumn: issue.End.Column,
+				Rule:      issue.Rule,
+				Severity:  issue.Severity,
+				Message:   issue.Message,
+			})
+		}
+	}
+
+	if *format == "json" {
+		fmt.Println(PrettyPrint(findings))
+	} else {
+		for _, finding := range findings {
+			fmt.Printf("%s:%d:%d: %s[%s]: %s\n", finding.File, finding.Line, finding.Column,
+				finding.Severity, finding.Rule, finding.Message)
+		}
+	}
+	if len(findings) > 0 && code == EXIT_OK {
+		code = EXIT_RUNTIME_ERROR
+	}
+	return code
+}
+
+func IsLintRule(name string) bool {
+	for _, rule := range core.LINT_RULES {
+		if rule == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// lsp serves the Language Server Protocol on stdin and stdout. Documents
+// are synced whole and analysed on every change: syntax errors and lint
+// issues are published as diagnostics, everything else comes from
+// core.Resolve
+
+// kinds of the protocol
+const (
+	ERROR_DIAGNOSTIC   = 1
+	WARNING_DIAGNOSTIC = 2
+
+	FUNCTION_SYMBOL_KIND = 12
+	VARIABLE_SYMBOL_KIND = 13
+
+	FUNCTION_COMPLETION = 3
+	VARIABLE_COMPLETION = 6
+	KEYWORD_COMPLETION  = 14
+
+	FULL_SYNC = 1
+)
+
+type LspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type LspRange struct {
+	Start LspPosition `json:"start"`
+	End   LspPosition `json:"end"`
+}
+
+type LspLocation struct {
+	URI   string   `json:"uri"`
+	Range LspRange `json:"range"`
+}
+
+type TextEdit struct {
+	Range   LspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type Diagnostic struct {
+	Range    LspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           int              `json:"kind"`
+	Range          LspRange         `json:"range"`
+	SelectionRange LspRange         `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
+type CompletionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// params of the requests about a position in a document
+type PositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position LspPosition `json:"position"`
+	Context  struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+	NewName string `json:"newName"`
+}
+
+// Document is an open file with the result of its analysis
+type Document struct {
+	URI        string
+	Text       string
+	lines      []string
+	Program    []core.STATEMENT_NODE
+	Errors     core.ErrorList
+	Resolution *core.Resolution
+}
+
+func NewDocument(uri, text string) *Document {
+	document := &Document{URI: uri, Text: text, lines: strings.Split(text, "\n")}
+	parser := core.NewParser(text)
+	document.Program, _ = parser.ParseProgram()
+	document.Errors = parser.Errors()
+	document.Resolution = core.Resolve(document.Program, []string{"args"})
+	return document
+}
+
+// converts a position of the lexer, 1-based and counting runes, to the
+// protocol's, 0-based and counting UTF-16 code units
+func (self *Document) LspPosition(pos core.Position) LspPosition {
+	if pos.Line < 1 {
+		return LspPosition{}
+	}
+	character := pos.Column - 1
+	if pos.Line <= len(self.lines) {
+		line := []rune(self.lines[pos.Line-1])
+		if character > len(line) {
+			character = len(line)
+		}
+		if character >= 0 {
+			character = len(utf16.Encode(line[:character]))
+		}
+	}
+	if character < 0 {
+		character = 0
+	}
+	return LspPosition{pos.Line - 1, character}
+}
+
+func (self *Document) Position(pos LspPosition) core.Position {
+	column := pos.Character
+	if pos.Line >= 0 && pos.Line < len(self.lines) {
+		units := utf16.Encode([]rune(self.lines[pos.Line]))
+		if column > len(units) {
+			column = len(units)
+		}
+		column = len(utf16.Decode(units[:column]))
+	}
+	return core.Position{Line: pos.Line + 1, Column: column + 1}
+}
+
+func (self *Document) Range(span core.Span) LspRange {
+	end := span.End
+	if core.Before(end, span.Start) {
+		end = span.Start
+	}
+	return LspRange{self.LspPosition(span.Start), self.LspPosition(end)}
+}
+
+func (self *Document) Location(span core.Span) LspLocation {
+	return LspLocation{self.URI, self.Range(span)}
+}
+
+func (self *Document) Diagnostics() []Diagnostic {
+	diagnostics := []Diagnostic{}
+	for _, err := range self.Errors {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    self.Range(core.Span{Start: err.Start, End: err.End}),
+			Severity: ERROR_DIAGNOSTIC,
+			Code:     err.Code,
+			Source:   "interpreter",
+			Message:  err.Message,
+		})
+	}
+	for _, issue := range self.Resolution.Issues(core.DefaultLintConfig()) {
+		severity := WARNING_DIAGNOSTIC
+		if issue.Severity == core.ERROR_SEVERITY {
+			severity = ERROR_DIAGNOSTIC
+		}
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    self.Range(core.Span{Start: issue.Start, End: issue.End}),
+			Severity: severity,
+			Code:     issue.Rule,
+			Source:   "interpreter",
+			Message:  issue.Message,
+		})
+	}
+	return diagnostics
+}
+
+// a function symbol with the functions and variables declared in it
+func (self *Document) Symbols(parent *core.Symbol) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, symbol := range self.Resolution.Symbols {
+		if symbol.Parent != parent || symbol.Kind == core.PARAMETER_SYMBOL {
+			continue
+		}
+		kind := VARIABLE_SYMBOL_KIND
+		children := []DocumentSymbol(nil)
+		if symbol.Kind == core.FUNCTION_SYMBOL {
+			kind = FUNCTION_SYMBOL_KIND
+			children = self.Symbols(symbol)
+		}
+		symbols = append(symbols, DocumentSymbol{
+			Name:           symbol.Name,
+			Detail:         Signature(symbol),
+			Kind:           kind,
+			Range:          self.Range(symbol.Declaration),
+			SelectionRange: self.Range(symbol.Span),
+			Children:       children,
+		})
+	}
+	return symbols
+}
+
+// how a symbol is declared, e.g. "fn add: a, b"
+func Signature(symbol *core.Symbol) string {
+	switch symbol.Kind {
+	case core.FUNCTION_SYMBOL:
+		signature := "fn " + symbol.Name + ":"
+		if len(symbol.Params) > 0 {
+			signature += " " + strings.Join(symbol.Params, ", ")
+		}
+		return signature
+	case core.PARAMETER_SYMBOL:
+		return "parameter " + symbol.Name
+	default:
+		return "let " + symbol.Name
+	}
+}
+
+type LspServer struct {
+	conn      *RpcConn
+	documents map[string]*Document
+	shutdown  bool
+}
+
+func LspCommand(args []string) int {
+	flags := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	// editors pass --stdio, it is the only transport
+	flags.Bool("stdio", true, "talk over stdin and stdout")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	server := &LspServer{conn: NewRpcConn(os.Stdin, os.Stdout), documents: make(map[string]*Document)}
+	return server.Serve()
+}
+
+// handles messages until "exit" or the end of input
+func (self *LspServer) Serve() int {
+	for {
+		message, err := self.conn.Read()
+		if err == io.EOF {
+			return EXIT_RUNTIME_ERROR
+		}
+		var rpcErr *RpcError
+		if errors.As(err, &rpcErr) {
+			self.conn.Reply(nil, nil, rpcErr)
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return EXIT_RUNTIME_ERROR
+		}
+		if message.Method == "exit" {
+			if self.shutdown {
+				return EXIT_OK
+			}
+			return EXIT_RUNTIME_ERROR
+		}
+		result, err := self.Handle(message)
+		if message.ID != nil {
+			self.conn.Reply(message.ID, result, err)
+		}
+	}
+}
+
+func (self *LspServer) Handle(message *RpcMessage) (interface{}, error) {
+	switch message.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       FULL_SYNC,
+				"documentSymbolProvider": true,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"renameProvider":         true,
+				"completionProvider":     map[string]interface{}{},
+			},
+			"serverInfo": map[string]string{"name": "interpreter"},
+		}, nil
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		self.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, NewRpcError(INVALID_PARAMS_RPC, "%s", err)
+		}
+		self.Open(params.TextDocument.URI, params.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, NewRpcError(INVALID_PARAMS_RPC, "%s", err)
+		}
+		// with full sync the last change is the whole text
+		if changes := params.ContentChanges; len(changes) > 0 {
+			self.Open(params.TextDocument.URI, changes[len(changes)-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params PositionParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, NewRpcError(INVALID_PARAMS_RPC, "%s", err)
+		}
+		delete(self.documents, params.TextDocument.URI)
+		self.conn.Notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri": params.TextDocument.URI, "diagnostics": []Diagnostic{},
+		})
+		return nil, nil
+	case "textDocument/documentSymbol", "textDocument/definition", "textDocument/references",
+		"textDocument/hover", "textDocument/completion", "textDocument/rename":
+		var params PositionParams
+		if err := json.Unmarshal(message.Params, &params); err != nil {
+			return nil, NewRpcError(INVALID_PARAMS_RPC, "%s", err)
+		}
+		document, ok := self.documents[params.TextDocument.URI]
+		if !ok {
+			return nil, NewRpcError(INVALID_PARAMS_RPC, "document %s is not open", params.TextDocument.URI)
+		}
+		return self.Query(message.Method, document, &params)
+	}
+	if message.ID == nil {
+		// unknown notifications are ignored
+		return nil, nil
+	}
+	return nil, NewRpcError(METHOD_NOT_FOUND_RPC, "method %s is not supported", message.Method)
+}
+
+func (self *LspServer) Open(uri, text string) {
+	document := NewDocument(uri, text)
+	self.documents[uri] = document
+	self.conn.Notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri": uri, "diagnostics": document.Diagnostics(),
+	})
+}
+
+// answers a request about a document
+func (self *LspServer) Query(method string, document *Document, params *PositionParams) (interface{}, error) {
+	pos := document.Position(params.Position)
+	symbol := document.Resolution.SymbolAt(pos)
+
+	switch method {
+	case "textDocument/documentSymbol":
+		return document.Symbols(nil), nil
+	case "textDocument/completion":
+		return document.Completions(pos), nil
+	case "textDocument/definition":
+		if symbol == nil {
+			return nil, nil
+		}
+		return document.Location(symbol.Span), nil
+	case "textDocument/references":
+		locations := []LspLocation{}
+		if symbol == nil {
+			return locations, nil
+		}
+		if params.Context.IncludeDeclaration {
+			locations = append(locations, document.Location(symbol.Span))
+		}
+		for _, reference := range symbol.References {
+			locations = append(locations, document.Location(reference))
+		}
+		return locations, nil
+	case "textDocument/hover":
+		if symbol == nil {
+			return nil, nil
+		}
+		value := "```\n" + Signature(symbol) + "\n```"
+		if symbol.Doc != "" {
+			value += "\n\n" + symbol.Doc
+		}
+		return map[string]interface{}{
+			"contents": map[string]string{"kind": "markdown", "value": value},
+			"range":    document.Range(symbol.Span),
+		}, nil
+	case "textDocument/rename":
+		if symbol == nil {
+			return nil, NewRpcError(REQUEST_FAILED_RPC, "no symbol to rename here")
+		}
+		if !IsIdentifier(params.NewName) {
+			return nil, NewRpcError(REQUEST_FAILED_RPC, "%q is not a valid name", params.NewName)
+		}
+		if IsBuiltinName(params.NewName) {
+			return nil, NewRpcError(REQUEST_FAILED_RPC, "%q would shadow the builtin", params.NewName)
+		}
+		if other := document.Resolution.RenameConflict(symbol, params.NewName); other != nil {
+			return nil, NewRpcError(REQUEST_FAILED_RPC, "%q would clash with the %s declared %s",
+				params.NewName, other.Kind, other.Span.Start.Format())
+		}
+		edits := []TextEdit{{document.Range(symbol.Span), params.NewName}}
+		for _, reference := range symbol.References {
+			edits = append(edits, TextEdit{document.Range(reference), params.NewName})
+		}
+		return map[string]interface{}{
+			"changes": map[string][]TextEdit{document.URI: edits},
+		}, nil
+	}
+	return nil, nil
+}
+
+// keywords, builtins and the names in scope at pos
+func (self *Document) Completions(pos core.Position) []CompletionItem {
+	items := []CompletionItem{}
+	for _, symbol := range self.Resolution.Visible(pos) {
+		kind := VARIABLE_COMPLETION
+		if symbol.Kind == core.FUNCTION_SYMBOL {
+			kind = FUNCTION_COMPLETION
+		}
+		items = append(items, CompletionItem{symbol.Name, kind, Signature(symbol)})
+	}
+	builtins := []string{}
+	for _, group := range core.Builtins {
+		for name := range group {
+			builtins = append(builtins, name)
+		}
+	}
+	sort.Strings(builtins)
+	for _, name := range builtins {
+		items = append(items, CompletionItem{name, FUNCTION_COMPLETION, "builtin"})
+	}
+	items = append(items, CompletionItem{"args", VARIABLE_COMPLETION, "script arguments"})
+	for _, keyword := range core.KEYWORDS {
+		items = append(items, CompletionItem{keyword, KEYWORD_COMPLETION, ""})
+	}
+	for _, literal := range []string{"true", "false", "null"} {
+		items = append(items, CompletionItem{literal, KEYWORD_COMPLETION, ""})
+	}
+	return items
+}
+
+// builtins and the globals the cli defines
+func IsBuiltinName(name string) bool {
+	if name == "args" {
+		return true
+	}
+	for _, group := range core.Builtins {
+		if _, ok := group[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checks if name lexes as a single identifier
+func IsIdentifier(name string) bool {
+	lexer := core.NewLexer(name)
+	token := lexer.Next()
+	return token.Type == core.ID_TOKEN && token.Literal == name && lexer.Next().Type == core.EOF_TOKEN
+}
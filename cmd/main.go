@@ -2,31 +2,146 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"interpreter/core"
+	"io"
+	"os"
 )
 
+// exit codes of the interpreter itself, exit(n) in a script exits with n
+const (
+	EXIT_OK            = 0
+	EXIT_RUNTIME_ERROR = 1
+	EXIT_SYNTAX_ERROR  = 2
+	EXIT_USAGE         = 64
+	EXIT_INTERRUPTED   = 130
+)
+
+const USAGE = `usage:
+  interpreter run [flags] file [args...]   run a script
+  interpreter run [flags] -e code [args...]
+  interpreter run [flags] - [args...]      read the script from stdin
+  interpreter [flags] file [args...]       same as run
+  interpreter repl [--sandbox] [--no-history]
+                                           interactive session, also started
+                                           by a bare "interpreter" in a terminal
+  interpreter fmt [--check | --write] [files...]
+                                           format scripts, stdin without files
+  interpreter lint [--enable rules] [--disable rules] [--config file]
+                   [--format text|json] [--rules] [files...]
+                                           report likely mistakes, exits with 1
+                                           if there are any
+  interpreter lsp [--stdio]                language server on stdin and stdout
+  interpreter debug [--sandbox] file [args...]
+                                           run a script in the step debugger
+  interpreter debug --dap                  debug adapter on stdin and stdout
+  interpreter test [--run regexp] [--parallel n] [--format text|tap|junit]
+                   [-v] [--sandbox] [--timeout d] [files or dirs...]
+                                           run the test_ functions of the files
+                                           and of the *_test.it files in dirs,
+                                           each for at most --timeout (10m)
+
+flags:
+  -e code               run code instead of a file
+  --dump-tokens         print the tokens of the script instead of running it
+  --dump-ast            print the syntax tree of the script as JSON instead of running it
+  --sandbox             deny the fs, env and process builtins
+  --profile             print the time per function and the hits per statement to stderr
+  --pprof file          write a profile for go tool pprof, e.g. go tool pprof -http=: file
+  --coverage            print the statement and branch coverage to stderr
+  --coverage-html file  write the source annotated with coverage as HTML
+  --coverage-lcov file  write the coverage as an LCOV tracefile
+  --coverage-min n      exit with 1 unless at least n percent of the statements ran
+`
+
 func PrettyPrint(structure interface{}) string {
 	s, _ := json.MarshalIndent(structure, "", "\t")
 	return string(s)
 }
 
 func main() {
-	code := `           for true {
-		-true;
+	os.Exit(Main(os.Args[1:]))
+}
+
+func Main(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "run":
+			return RunCommand(args[1:])
+		case "repl":
+			return ReplCommand(args[1:])
+		case "fmt":
+			return FmtCommand(args[1:])
+		case "lint":
+			return LintCommand(args[1:])
+		case "lsp":
+			return LspCommand(args[1:])
+		case "debug":
+			return DebugCommand(args[1:])
+		case "test":
+			return TestCommand(args[1:])
+		case "help", "-h", "-help", "--help":
+			fmt.Print(USAGE)
+			return EXIT_OK
+		}
 	}
-	`
-	parser := core.NewParser(code)
-	ast, err := parser.ParseProgram()
-	if err != nil {
-		fmt.Println(err)
+	if len(args) == 0 && IsTerminal(os.Stdin) {
+		return ReplCommand(args)
 	}
+	return RunCommand(args)
+}
+
+func UsageError(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "error: %s\n\n%s", fmt.Sprintf(format, args...), USAGE)
+	return EXIT_USAGE
+}
 
-	fmt.Println(PrettyPrint(ast))
+// reads a script from path, "-" is stdin
+func ReadSource(path string) (string, error) {
+	if path == "-" {
+		code, err := io.ReadAll(os.Stdin)
+		return string(code), err
+	}
+	code, err := os.ReadFile(path)
+	return string(code), err
+}
 
-	interpreter := core.NewInterpreter()
-	res := interpreter.Interpret(ast)
+// writes err to w, errors with a position are shown with the line of
+// source they point at
+func ReportError(w io.Writer, err error, file, source string) {
+	var list core.ErrorList
+	if errors.As(err, &list) {
+		for _, scriptErr := range list {
+			ReportError(w, scriptErr, file, source)
+		}
+		if len(list) > 1 {
+			fmt.Fprintf(w, "%d errors\n", len(list))
+		}
+		return
+	}
+	scriptErr, ok := core.AsScriptError(err)
+	if !ok {
+		fmt.Fprintf(w, "error: %s\n", err)
+		return
+	}
+	if scriptErr.File == "" {
+		scriptErr.File = file
+	}
+	fmt.Fprint(w, scriptErr.Render(source))
+}
 
-	fmt.Println()
-	fmt.Println(res)
+// exit code for an error returned by Interpret
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_OK
+	}
+	var exitErr *core.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code
+	}
+	if errors.Is(err, core.ErrCancelled) {
+		return EXIT_INTERRUPTED
+	}
+	return EXIT_RUNTIME_ERROR
 }
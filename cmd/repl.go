@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	PROMPT              = ">> "
+	CONTINUATION_PROMPT = ".. "
+	HISTORY_FILE        = ".interpreter_history"
+)
+
+const REPL_HELP = `an empty line ends unfinished input, results of expressions are printed
+  :ast code      print the syntax tree of code
+  :tokens code   print the tokens of code
+  :load file     run file in this session
+  :reset         forget all definitions
+  :help          show this help
+  :quit          leave, as does Ctrl-D
+`
+
+// Repl keeps one interpreter, and so its globals, for a whole session
+type Repl struct {
+	editor      *LineEditor
+	interpreter *core.Interpreter
+	sandbox     bool
+}
+
+func ReplCommand(args []string) int {
+	flags := flag.NewFlagSet("repl", flag.ContinueOnError)
+	sandbox := flags.Bool("sandbox", false, "deny the fs, env and process builtins")
+	noHistory := flags.Bool("no-history", false, "do not read or write the history file")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	historyFile := ""
+	if home, err := os.UserHomeDir(); err == nil && !*noHistory {
+		historyFile = filepath.Join(home, HISTORY_FILE)
+	}
+	return NewRepl(NewLineEditor(historyFile), *sandbox).Run()
+}
+
+func NewRepl(editor *LineEditor, sandbox bool) *Repl {
+	repl := &Repl{editor: editor, sandbox: sandbox}
+	repl.Reset()
+	return repl
+}
+
+func (self *Repl) Reset() {
+	script := &Script{File: "<repl>", Args: []string{}}
+	self.interpreter = script.NewInterpreter(self.sandbox)
+	self.interpreter.AllowRedefinition(true)
+	self.interpreter.SetStdin(self.editor.Reader())
+}
+
+func (self *Repl) Run() int {
+	if self.editor.terminal {
+		fmt.Println("type :help for help, Ctrl-D to quit")
+	}
+	for {
+		input, err := self.ReadInput()
+		if err == ErrInterrupted {
+			continue
+		}
+		if err == io.EOF {
+			return EXIT_OK
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return EXIT_RUNTIME_ERROR
+		}
+		self.editor.AddHistory(input)
+
+		if command := strings.TrimSpace(input); strings.HasPrefix(command, ":") {
+			if quit := self.Command(command); quit {
+				return EXIT_OK
+			}
+			continue
+		}
+		var exitErr *core.ExitError
+		if err := self.Eval("<repl>", input); errors.As(err, &exitErr) {
+			return exitErr.Code
+		}
+	}
+}
+
+// reads lines until the input is complete, i.e. it parses or fails for
+// another reason than the missing end
+func (self *Repl) ReadInput() (string, error) {
+	lines := []string{}
+	prompt := PROMPT
+	for {
+		line, err := self.editor.ReadLine(prompt)
+		if err == io.EOF && len(lines) > 0 {
+			return strings.Join(lines, "\n"), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, line)
+		input := strings.Join(lines, "\n")
+		if len(lines) == 1 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			return input, nil
+		}
+		if len(lines) > 1 && strings.TrimSpace(line) == "" {
+			return input, nil
+		}
+		if !IsIncomplete(input) {
+			return input, nil
+		}
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+// checks if source only fails to parse because it ends too early,
+// e.g. inside an unclosed "{", "(", "[" or block comment
+func IsIncomplete(source string) bool {
+	_, err := core.NewParser(source).ParseProgram()
+	var list core.ErrorList
+	if !errors.As(err, &list) {
+		return false
+	}
+	for _, scriptErr := range list {
+		if scriptErr.Code == core.UNEXPECTED_EOF_CODE || scriptErr.Code == core.UNTERMINATED_COMMENT_CODE {
+			return true
+		}
+	}
+	return false
+}
+
+// runs source and prints the value of a trailing expression, errors are
+// reported and returned
+func (self *Repl) Eval(file, source string) error {
+	parser := core.NewParser(source)
+	parser.SetFile(file)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		ReportError(os.Stderr, err, file, source)
+		return err
+	}
+
+	// Ctrl-C stops the evaluation, not the session
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := self.interpreter.EvalProgram(ctx, program)
+	var exitErr *core.ExitError
+	if errors.As(err, &exitErr) {
+		return err
+	}
+	if err != nil {
+		ReportError(os.Stderr, err, file, source)
+		return err
+	}
+	if ShowsResult(program) && result.Typeof() != core.NULL_TYPE {
+		fmt.Println(Repr(result))
+	}
+	return nil
+}
+
+// results of assignments and of statements are not printed
+func ShowsResult(program []core.STATEMENT_NODE) bool {
+	if len(program) == 0 {
+		return false
+	}
+	statement, ok := program[len(program)-1].(*core.EXPRESSION_STATEMENT)
+	if !ok {
+		return false
+	}
+	_, assign := statement.Expression.(*core.BINARY_ASSIGN_EXPRESSION)
+	return !assign
+}
+
+// like ToString, but strings are quoted
+func Repr(obj core.Object) string {
+	if str, ok := obj.(core.STRING); ok {
+		return strconv.Quote(string(str))
+	}
+	return obj.ToString()
+}
+
+// runs a ":" command, the result tells if the session should end
+func (self *Repl) Command(command string) bool {
+	name, arg := command, ""
+	if i := strings.IndexAny(command, " \t"); i >= 0 {
+		name, arg = command[:i], strings.TrimSpace(command[i+1:])
+	}
+	switch name {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help", ":h":
+		fmt.Print(REPL_HELP)
+	case ":reset":
+		self.Reset()
+		fmt.Println("session reset")
+	case ":tokens":
+		DumpTokens(arg)
+	case ":ast":
+		program, err := core.NewParser(arg).ParseProgram()
+		if err != nil {
+			ReportError(os.Stderr, err, "<repl>", arg)
+		}
+		fmt.Println(PrettyPrint(program))
+	case ":load":
+		if arg == "" {
+			fmt.Fprintln(os.Stderr, "usage: :load file")
+			break
+		}
+		source, err := ReadSource(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			break
+		}
+		self.Eval(arg, source)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s, type :help for help\n", name)
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"interpreter/core"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestIsIncomplete(t *testing.T) {
+	tests := []struct {
+		source     string
+		incomplete bool
+	}{
+		{"say 1", false},
+		{"fn f: {", true},
+		{"if x > 1 {\nsay x", true},
+		{"let xs = [1,", true},
+		{"say (1 +", true},
+		{"let x = 1 +", true},
+		{"/* comment", true},
+		{"if x { say 1 }", false},
+		// errors before the end are not fixed by more input
+		{"let = 1 {", false},
+		{"say 1 }", false},
+	}
+	for _, test := range tests {
+		if incomplete := IsIncomplete(test.source); incomplete != test.incomplete {
+			t.Errorf("IsIncomplete(%q) = %t, want %t", test.source, incomplete, test.incomplete)
+		}
+	}
+}
+
+func testEditor(input string) *LineEditor {
+	return &LineEditor{in: bufio.NewReader(strings.NewReader(input)), out: ioutil.Discard}
+}
+
+func TestReadInput(t *testing.T) {
+	repl := NewRepl(testEditor("fn f: {\n  return 1\n}\nsay 2\nlet xs = [\n\nsay 3\n:help\n"), true)
+	want := []string{"fn f: {\n  return 1\n}", "say 2", "let xs = [\n", "say 3", ":help"}
+	for _, input := range want {
+		read, err := repl.ReadInput()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read != input {
+			t.Errorf("read %q, want %q", read, input)
+		}
+	}
+	if _, err := repl.ReadInput(); err != io.EOF {
+		t.Errorf("read past the end with %v", err)
+	}
+}
+
+// definitions entered again replace the old ones
+func TestRedefinition(t *testing.T) {
+	repl := NewRepl(testEditor(""), true)
+	for _, input := range []string{"fn f: { return 1 }", "fn f: { return 2 }", "let x = 1", "let x = x + 1"} {
+		if err := repl.Eval("<repl>", input); err != nil {
+			t.Fatalf("%q failed: %s", input, err)
+		}
+	}
+	result, err := repl.interpreter.Eval("f() + x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != core.INT(4) {
+		t.Errorf("f() + x = %s, want 4", result.ToString())
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"io"
+	"os"
+	"os/signal"
+)
+
+// a script to run, File names it in error messages
+type Script struct {
+	File   string
+	Source string
+	Args   []string
+}
+
+// the script given by -e, a file argument or stdin, the arguments after
+// it are passed to the script
+func LoadScript(code *string, codeSet bool, args []string) (*Script, error) {
+	if codeSet {
+		return &Script{"<-e>", *code, args}, nil
+	}
+	path := "-"
+	if len(args) > 0 {
+		path, args = args[0], args[1:]
+	}
+	source, err := ReadSource(path)
+	if err != nil {
+		return nil, err
+	}
+	file := path
+	if path == "-" {
+		file = "<stdin>"
+	}
+	return &Script{file, source, args}, nil
+}
+
+func (self *Script) Parse() ([]core.STATEMENT_NODE, error) {
+	parser := core.NewParser(self.Source)
+	parser.SetFile(self.File)
+	return parser.ParseProgram()
+}
+
+// an interpreter with the script arguments bound to args
+func (self *Script) NewInterpreter(sandbox bool) *core.Interpreter {
+	interpreter := core.NewInterpreter()
+	if !sandbox {
+		interpreter.SetPolicy(core.AllowAllPolicy())
+	}
+	interpreter.SetGlobal("args", self.Args)
+	return interpreter
+}
+
+func RunCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	code := flags.String("e", "", "run code instead of a file")
+	dumpTokens := flags.Bool("dump-tokens", false, "print the tokens of the script")
+	dumpAst := flags.Bool("dump-ast", false, "print the syntax tree of the script")
+	sandbox := flags.Bool("sandbox", false, "deny the fs, env and process builtins")
+	profile := flags.Bool("profile", false, "print the time per function and the hits per statement")
+	pprof := flags.String("pprof", "", "write a profile for go tool pprof to a file")
+	coverage := flags.Bool("coverage", false, "print the statement and branch coverage")
+	coverageHtml := flags.String("coverage-html", "", "write the source annotated with coverage to an HTML file")
+	coverageLcov := flags.String("coverage-lcov", "", "write the coverage to an LCOV file")
+	coverageMin := flags.Float64("coverage-min", 0, "fail unless at least this percent of the statements ran")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	codeSet := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "e" {
+			codeSet = true
+		}
+	})
+
+	script, err := LoadScript(code, codeSet, flags.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return EXIT_USAGE
+	}
+	if *dumpTokens {
+		DumpTokens(script.Source)
+		return EXIT_OK
+	}
+
+	program, err := script.Parse()
+	if *dumpAst {
+		fmt.Println(PrettyPrint(program))
+	}
+	if err != nil {
+		ReportError(os.Stderr, err, script.File, script.Source)
+		return EXIT_SYNTAX_ERROR
+	}
+	if *dumpAst {
+		return EXIT_OK
+	}
+
+	// Ctrl-C cancels the script instead of killing the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	interpreter := script.NewInterpreter(*sandbox)
+	var profiler *core.Profiler
+	if *profile || *pprof != "" {
+		profiler = core.NewProfiler()
+		interpreter.SetProfiler(profiler)
+		profiler.Start()
+	}
+	var tracked *core.Coverage
+	if *coverage || *coverageHtml != "" || *coverageLcov != "" || *coverageMin > 0 {
+		tracked = core.NewCoverage(program)
+		interpreter.SetCoverage(tracked)
+	}
+	err = interpreter.Interpret(ctx, program)
+	var exitErr *core.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		ReportError(os.Stderr, err, script.File, script.Source)
+	}
+	if profiler != nil {
+		profiler.Stop()
+		if profileErr := WriteProfile(profiler, script, *profile, *pprof); profileErr != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", profileErr)
+			if err == nil {
+				return EXIT_USAGE
+			}
+		}
+	}
+	if tracked != nil {
+		if coverageErr := WriteCoverage(tracked, script, *coverage, *coverageHtml, *coverageLcov); coverageErr != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", coverageErr)
+			if err == nil {
+				return EXIT_USAGE
+			}
+		}
+		percent := tracked.Summary().StatementPercent()
+		if err == nil && percent < *coverageMin {
+			fmt.Fprintf(os.Stderr, "statement coverage %.1f%% is below %.1f%%\n", percent, *coverageMin)
+			return EXIT_RUNTIME_ERROR
+		}
+	}
+	return ExitCode(err)
+}
+
+// lines of the statement table of --profile
+const PROFILE_STATEMENTS = 20
+
+// prints the profile table to stderr and writes the pprof file
+func WriteProfile(profiler *core.Profiler, script *Script, table bool, pprof string) error {
+	if table {
+		fmt.Fprintln(os.Stderr)
+		profiler.WriteTable(os.Stderr, script.Source, PROFILE_STATEMENTS)
+	}
+	if pprof == "" {
+		return nil
+	}
+	file, err := os.Create(pprof)
+	if err != nil {
+		return err
+	}
+	if err := profiler.WritePprof(file, script.File); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// prints the coverage summary to stderr and writes the reports
+func WriteCoverage(coverage *core.Coverage, script *Script, summary bool, htmlFile, lcovFile string) error {
+	if summary {
+		fmt.Fprintln(os.Stderr)
+		coverage.WriteSummary(os.Stderr, script.File)
+	}
+	if htmlFile != "" {
+		if err := WriteReport(htmlFile, func(w io.Writer) {
+			coverage.WriteHtml(w, script.File, script.Source)
+		}); err != nil {
+			return err
+		}
+	}
+	if lcovFile != "" {
+		return WriteReport(lcovFile, func(w io.Writer) {
+			coverage.WriteLcov(w, script.File)
+		})
+	}
+	return nil
+}
+
+// creates path and writes to it through a buffer
+func WriteReport(path string, write func(w io.Writer)) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewWriter(file)
+	write(buffered)
+	if err := buffered.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// prints a token per line: position, type and literal
+func DumpTokens(source string) {
+	lexer := core.NewLexer(source)
+	for {
+		token := lexer.Next()
+		fmt.Printf("%d:%d\t%s\t%q\n", token.Line, token.Column, token.Type.Format(), token.Literal)
+		if token.Type == core.EOF_TOKEN {
+			return
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"interpreter/core"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files a directory argument of test is searched for
+const TEST_FILE_SUFFIX = "_test.it"
+
+// name of the result of a test file that does not parse
+const PARSE_TEST = "<parse>"
+
+// how long a test may run by default, so a test that hangs fails
+const DEFAULT_TEST_TIMEOUT = 10 * time.Minute
+
+// a parsed test file
+type TestFile struct {
+	Path    string
+	Source  string
+	Program []core.STATEMENT_NODE
+}
+
+type TestResult struct {
+	File string
+	Name string
+	// the error as ReportError prints it, empty if the test passed
+	Failure string
+	// whether Failure is a failed assertion and not another error
+	Assertion bool
+	// what the test printed
+	Output   string
+	Duration time.Duration
+}
+
+func (self *TestResult) Passed() bool {
+	return self.Failure == ""
+}
+
+// test runs the test_ functions of the files and of the *_test.it files
+// in the directories, each in its own interpreter. It exits with 1 if a
+// test fails and with 2 if a file does not parse
+func TestCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, USAGE) }
+	run := flags.String("run", "", "only run the tests whose names match a regular expression")
+	parallel := flags.Int("parallel", runtime.NumCPU(), "number of tests to run at once")
+	format := flags.String("format", "text", "output format, text, tap or junit")
+	verbose := flags.Bool("v", false, "also list the tests that pass, with their output")
+	sandbox := flags.Bool("sandbox", false, "deny the fs, env and process builtins")
+	timeout := flags.Duration("timeout", DEFAULT_TEST_TIMEOUT, "fail a test running longer than this, 0 for no limit")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return EXIT_OK
+		}
+		return EXIT_USAGE
+	}
+	if *format != "text" && *format != "tap" && *format != "junit" {
+		return UsageError("unknown format %s", *format)
+	}
+	if *parallel < 1 {
+		return UsageError("--parallel must be at least 1")
+	}
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return UsageError("invalid --run: %s", err)
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := FindTestFiles(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		return EXIT_USAGE
+	}
+
+	// the results of files that do not parse come first
+	code := EXIT_OK
+	results := []*TestResult{}
+	type job struct {
+		file *TestFile
+		name string
+	}
+	jobs := []job{}
+	for _, path := range files {
+		file, result := ParseTestFile(path)
+		if result != nil {
+			results = append(results, result)
+			code = EXIT_SYNTAX_ERROR
+			continue
+		}
+		for _, test := range core.TestFunctions(file.Program) {
+			if filter.MatchString(test.Name) {
+				jobs = append(jobs, job{file, test.Name})
+			}
+		}
+	}
+
+	// Ctrl-C cancels the running tests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	start := time.Now()
+	ran := make([]*TestResult, len(jobs))
+	next := make(chan int)
+	var wait sync.WaitGroup
+	for worker := 0; worker < *parallel && worker < len(jobs); worker++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range next {
+				ran[i] = RunTestFunction(ctx, jobs[i].file, jobs[i].name, *sandbox, *timeout)
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wait.Wait()
+	results = append(results, ran...)
+	elapsed := time.Since(start)
+
+	switch *format {
+	case "tap":
+		WriteTap(os.Stdout, results)
+	case "junit":
+		if err := WriteJUnit(os.Stdout, results, elapsed); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %s\n", err)
+			return EXIT_USAGE
+		}
+	default:
+		WriteTestText(os.Stdout, results, len(files), elapsed, *verbose)
+	}
+
+	for _, result := range results {
+		if !result.Passed() && code == EXIT_OK {
+			code = EXIT_RUNTIME_ERROR
+		}
+	}
+	if ctx.Err() != nil {
+		return EXIT_INTERRUPTED
+	}
+	return code
+}
+
+// the files among paths and the test files in the directories among
+// them, in order
+func FindTestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, TEST_FILE_SUFFIX) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// the file, or a failed result if it cannot be read or parsed
+func ParseTestFile(path string) (*TestFile, *TestResult) {
+	source, err := ReadSource(path)
+	if err == nil {
+		parser := core.NewParser(source)
+		parser.SetFile(path)
+		var program []core.STATEMENT_NODE
+		if program, err = parser.ParseProgram(); err == nil {
+			return &TestFile{path, source, program}, nil
+		}
+	}
+	var failure strings.Builder
+	ReportError(&failure, err, path, source)
+	return nil, &TestResult{File: path, Name: PARSE_TEST, Failure: failure.String()}
+}
+
+// runs a test in a fresh interpreter with its output captured and no
+// input
+func RunTestFunction(ctx context.Context, file *TestFile, name string, sandbox bool, timeout time.Duration) *TestResult {
+	var output strings.Builder
+	script := &Script{file.Path, file.Source, []string{}}
+	interpreter := script.NewInterpreter(sandbox)
+	interpreter.SetStdin(strings.NewReader(""))
+	interpreter.SetStdout(&output)
+	interpreter.SetStderr(&output)
+	interpreter.SetTimeout(timeout)
+
+	start := time.Now()
+	err := interpreter.RunTest(ctx, file.Program, name)
+	result := &TestResult{File: file.Path, Name: name, Duration: time.Since(start)}
+	switch {
+	case errors.Is(err, core.ErrTimeout):
+		// the error has no position, the name tells which test hangs
+		result.Failure = fmt.Sprintf("error: %s in %s timed out after %s\n", name, file.Path, timeout)
+	case err != nil:
+		var failure strings.Builder
+		ReportError(&failure, err, file.Path, file.Source)
+		result.Failure = failure.String()
+		result.Assertion = errors.Is(err, core.ErrAssertion)
+	}
+	result.Output = output.String()
+	return result
+}
+
+// "--- FAIL" with the error and output per failed test, "--- PASS" per
+// passed one if verbose, and a summary
+func WriteTestText(w io.Writer, results []*TestResult, files int, elapsed time.Duration, verbose bool) {
+	failed := 0
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed() {
+			status = "FAIL"
+			failed++
+		} else if !verbose {
+			continue
+		}
+		fmt.Fprintf(w, "--- %s: %s (%s, %s)\n", status, result.Name, result.File, core.FormatDuration(result.Duration))
+		if !result.Passed() {
+			fmt.Fprint(w, Indent(result.Failure, "    "))
+		}
+		if result.Output != "" {
+			fmt.Fprintf(w, "    output:\n%s", Indent(result.Output, "    | "))
+		}
+	}
+	if len(results) == 0 {
+		fmt.Fprintln(w, "no tests to run")
+		return
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d of %d tests failed in %d files (%s)\n", failed, len(results), files, core.FormatDuration(elapsed))
+	} else {
+		fmt.Fprintf(w, "ok: %d tests passed in %d files (%s)\n", len(results), files, core.FormatDuration(elapsed))
+	}
+}
+
+// prefixes every line of text, which ends with a newline afterwards
+func Indent(text, prefix string) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix) + "\n"
+}
+
+// Test Anything Protocol version 13, failures and output go in YAML
+// blocks
+func WriteTap(w io.Writer, results []*TestResult) {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results))
+	for i, result := range results {
+		status := "ok"
+		if !result.Passed() {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s %s\n", status, i+1, result.File, result.Name)
+		if result.Passed() && result.Output == "" {
+			continue
+		}
+		fmt.Fprintln(w, "  ---")
+		fmt.Fprintf(w, "  duration_ms: %.3f\n", float64(result.Duration)/float64(time.Millisecond))
+		if !result.Passed() {
+			fmt.Fprintf(w, "  message: |\n%s", Indent(result.Failure, "    "))
+		}
+		if result.Output != "" {
+			fmt.Fprintf(w, "  output: |\n%s", Indent(result.Output, "    "))
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+}
+
+type JUnitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*JUnitTestSuite `xml:"testsuite"`
+}
+
+// the tests of a file
+type JUnitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*JUnitTestCase `xml:"testcase"`
+	duration time.Duration
+}
+
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *JUnitFailure `xml:"failure,omitempty"`
+	Error     *JUnitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit XML as read by most CI servers, a failed assertion is a failure
+// and any other error an error
+func WriteJUnit(w io.Writer, results []*TestResult, elapsed time.Duration) error {
+	report := &JUnitTestSuites{Time: JUnitTime(elapsed)}
+	suites := make(map[string]*JUnitTestSuite)
+	for _, result := range results {
+		suite, ok := suites[result.File]
+		if !ok {
+			suite = &JUnitTestSuite{Name: result.File}
+			suites[result.File] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+		testCase := &JUnitTestCase{
+			Name:      result.Name,
+			ClassName: result.File,
+			Time:      JUnitTime(result.Duration),
+			SystemOut: result.Output,
+		}
+		if !result.Passed() {
+			message := strings.SplitN(result.Failure, "\n", 2)[0]
+			failure := &JUnitFailure{Message: message, Type: "error", Text: result.Failure}
+			if result.Assertion {
+				failure.Type = "assertion"
+				testCase.Failure = failure
+				suite.Failures++
+				report.Failures++
+			} else {
+				testCase.Error = failure
+				suite.Errors++
+				report.Errors++
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+		suite.Tests++
+		suite.duration += result.Duration
+		suite.Time = JUnitTime(suite.duration)
+		report.Tests++
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// seconds with millisecond precision
+func JUnitTime(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
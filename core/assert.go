@@ -0,0 +1,190 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The assertions of test scripts, see testing.go. A failing assertion
+// returns an AssertionError, those comparing two values carry a diff of
+// their ToString output
+
+var ErrAssertion = errors.New("assertion failed")
+
+type AssertionError struct {
+	Message string
+	// the expected and the actual value compared by LineDiff, empty if
+	// there is nothing to compare
+	Diff string
+}
+
+func (self *AssertionError) Error() string {
+	if self.Diff == "" {
+		return self.Message
+	}
+	return self.Message + "\n" + self.Diff
+}
+
+// errors.Is(err, ErrAssertion) finds every failed assertion
+func (self *AssertionError) Unwrap() error {
+	return ErrAssertion
+}
+
+func init() {
+	RegisterBuiltin(CORE_CAPABILITY, "assert", builtinAssert)
+	RegisterBuiltin(CORE_CAPABILITY, "assert_eq", builtinAssertEq)
+	RegisterBuiltin(CORE_CAPABILITY, "assert_ne", builtinAssertNe)
+	RegisterBuiltin(CORE_CAPABILITY, "expect_error", builtinExpectError)
+	RegisterBuiltin(CORE_CAPABILITY, "fail", builtinFail)
+}
+
+// the optional message argument at index, prefixed to the failure
+func assertMessage(name string, args []Object, index int, failure string) string {
+	if len(args) > index {
+		return fmt.Sprintf("%s: %s: %s", name, args[index].ToString(), failure)
+	}
+	return fmt.Sprintf("%s: %s", name, failure)
+}
+
+// assert(condition[, message])
+func builtinAssert(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("assert", args, 1, 2); err != nil {
+		return nil, err
+	}
+	ok, err := args[0].ToBoolean()
+	if err != nil {
+		return nil, ArgTypeError("assert", args[0])
+	}
+	if !ok {
+		return nil, &AssertionError{Message: assertMessage("assert", args, 1, "condition is false")}
+	}
+	return NULL{}, nil
+}
+
+// assert_eq(actual, expected[, message]), the values are compared like ==
+func builtinAssertEq(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("assert_eq", args, 2, 3); err != nil {
+		return nil, err
+	}
+	actual, expected := args[0], args[1]
+	if Equals(actual, expected) {
+		return NULL{}, nil
+	}
+	failure := "values differ"
+	if actual.ToString() == expected.ToString() {
+		failure = fmt.Sprintf("values differ, expected %s, found %s", Typeof(expected), Typeof(actual))
+	}
+	return nil, &AssertionError{
+		Message: assertMessage("assert_eq", args, 2, failure),
+		Diff:    LineDiff(expected.ToString(), actual.ToString()),
+	}
+}
+
+// assert_ne(actual, other[, message])
+func builtinAssertNe(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("assert_ne", args, 2, 3); err != nil {
+		return nil, err
+	}
+	if !Equals(args[0], args[1]) {
+		return NULL{}, nil
+	}
+	return nil, &AssertionError{
+		Message: assertMessage("assert_ne", args, 2, fmt.Sprintf("both values are %s", args[0].ToString())),
+	}
+}
+
+// expect_error(fn[, text]) calls fn without arguments and fails unless
+// the call fails with an error containing text. It returns the error
+// message, so tests can look closer at it
+func builtinExpectError(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("expect_error", args, 1, 2); err != nil {
+		return nil, err
+	}
+	fn, ok := args[0].(CALLABLE)
+	if !ok {
+		return nil, ArgTypeError("expect_error", args[0])
+	}
+	text := ""
+	if len(args) > 1 {
+		str, ok := args[1].(STRING)
+		if !ok {
+			return nil, ArgTypeError("expect_error", args[1])
+		}
+		text = string(str)
+	}
+
+	_, err := fn.Call(interpreter, []Object{})
+	switch {
+	case err == nil:
+		return nil, &AssertionError{Message: "expect_error: the call did not fail"}
+	case errors.Is(err, ErrAssertion), errors.Is(err, ErrCancelled), errors.Is(err, ErrTimeout):
+		// failed assertions and the limits are not the error expected
+		return nil, err
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return nil, err
+	}
+	message := ToScriptError(RUNTIME_ERROR, err).Message
+	if !strings.Contains(message, text) {
+		return nil, &AssertionError{
+			Message: fmt.Sprintf("expect_error: the error does not contain %q", text),
+			Diff:    LineDiff(text, message),
+		}
+	}
+	return STRING(message), nil
+}
+
+// fail([message])
+func builtinFail(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("fail", args, 0, 1); err != nil {
+		return nil, err
+	}
+	message := "fail"
+	if len(args) > 0 {
+		message = "fail: " + args[0].ToString()
+	}
+	return nil, &AssertionError{Message: message}
+}
+
+// compares expected and actual line by line, the lines only expected
+// are prefixed with "-", those only found with "+"
+func LineDiff(expected, actual string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	// common[i][j] is the length of the longest common subsequence of
+	// a[i:] and b[j:]
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	lines := []string{"--- expected", "+++ actual"}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return strings.Join(lines, "\n")
+}
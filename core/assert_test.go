@@ -0,0 +1,67 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		diff             []string
+	}{
+		{"a", "a", []string{"  a"}},
+		{"a", "b", []string{"- a", "+ b"}},
+		{"a\nb\nc", "a\nx\nc", []string{"  a", "- b", "+ x", "  c"}},
+		{"a\nb\nc", "a\nc", []string{"  a", "- b", "  c"}},
+		{"a\nc", "a\nb\nc", []string{"  a", "+ b", "  c"}},
+		{"a\nb", "b\na", []string{"- a", "  b", "+ a"}},
+		{"", "a", []string{"- ", "+ a"}},
+		{"x\ny\nz", "z\ny\nx", []string{"- x", "- y", "  z", "+ y", "+ x"}},
+	}
+	for _, test := range tests {
+		diff := LineDiff(test.expected, test.actual)
+		want := strings.Join(append([]string{"--- expected", "+++ actual"}, test.diff...), "\n")
+		if diff != want {
+			t.Errorf("LineDiff(%q, %q) =\n%s\nwant\n%s", test.expected, test.actual, diff, want)
+		}
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	tests := []struct {
+		source string
+		// the failure message, empty if the assertions pass
+		failure string
+	}{
+		{"assert(1 < 2)", ""},
+		{"assert(1 > 2)", "assert: condition is false"},
+		{"assert(false, \"sorted\")", "assert: sorted: condition is false"},
+		{"assert_eq([1, 2], [1, 2])", ""},
+		{"assert_eq(1, 2)", "assert_eq: values differ\n--- expected\n+++ actual\n- 2\n+ 1"},
+		{"assert_eq(\"1\", 1)", "assert_eq: values differ, expected INTEGER, found STRING\n--- expected\n+++ actual\n  1"},
+		{"assert_ne(1, 2)", ""},
+		{"assert_ne(1, 1)", "assert_ne: both values are 1"},
+		{"say expect_error(fn: { return 1 / 0 }, \"zero\")", ""},
+		{"expect_error(fn: { return 1 })", "expect_error: the call did not fail"},
+		{"fail(\"never\")", "fail: never"},
+	}
+	for _, test := range tests {
+		_, err := runScript(t, test.source)
+		if test.failure == "" {
+			if err != nil {
+				t.Errorf("%s failed: %s", test.source, err)
+			}
+			continue
+		}
+		var assertion *AssertionError
+		if !errors.As(err, &assertion) || !errors.Is(err, ErrAssertion) {
+			t.Errorf("%s failed with %v, want an assertion", test.source, err)
+			continue
+		}
+		if assertion.Error() != test.failure {
+			t.Errorf("%s failed with %q, want %q", test.source, assertion.Error(), test.failure)
+		}
+	}
+}
@@ -9,151 +9,232 @@ type Position struct {
 }
 
 func (self Position) Format() string {
-	return fmt.Sprintf("at line %d, at coolumn %d", self.Line, self.Column)
+	return fmt.Sprintf("at line %d, column %d", self.Line, self.Column)
+}
+
+// Start is the first character of a node, End the one right after it
+type Span struct {
+	Start, End Position
 }
 
 type STATEMENT_NODE interface {
 	statementNode()
 	GetPosition() Position
+	// position right after the statement
+	GetEnd() Position
+	setEnd(Position)
 }
 
 type EXPRESSION_NODE interface {
 	expressionNode()
+	GetSpan() Span
 }
 
 // STATEMENTS:
 
 type BREAK_STATEMENT struct {
 	Position
+	End Position
 }
 
 func (s *BREAK_STATEMENT) statementNode()        {}
 func (s *BREAK_STATEMENT) GetPosition() Position { return s.Position }
+func (s *BREAK_STATEMENT) GetEnd() Position      { return s.End }
+func (s *BREAK_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type CONTINUE_STATEMENT struct {
 	Position
+	End Position
 }
 
 func (s *CONTINUE_STATEMENT) statementNode()        {}
 func (s *CONTINUE_STATEMENT) GetPosition() Position { return s.Position }
+func (s *CONTINUE_STATEMENT) GetEnd() Position      { return s.End }
+func (s *CONTINUE_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type RETURN_STATEMENT struct {
 	Expression EXPRESSION_NODE
 	Position
+	End Position
 }
 
 func (s *RETURN_STATEMENT) statementNode()        {}
 func (s *RETURN_STATEMENT) GetPosition() Position { return s.Position }
+func (s *RETURN_STATEMENT) GetEnd() Position      { return s.End }
+func (s *RETURN_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type LET_STATEMENT struct {
 	Identifier string
+	// where the identifier is written
+	Name       Span
 	Expression EXPRESSION_NODE
+	Doc        string
 	Position
+	End Position
 }
 
 func (s *LET_STATEMENT) statementNode()        {}
 func (s *LET_STATEMENT) GetPosition() Position { return s.Position }
+func (s *LET_STATEMENT) GetEnd() Position      { return s.End }
+func (s *LET_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type FOR_STATEMENT struct {
 	Condition EXPRESSION_NODE
 	Body      []STATEMENT_NODE
 	Position
+	End Position
 }
 
 func (s *FOR_STATEMENT) statementNode()        {}
 func (s *FOR_STATEMENT) GetPosition() Position { return s.Position }
+func (s *FOR_STATEMENT) GetEnd() Position      { return s.End }
+func (s *FOR_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type IF_STATEMENT struct {
 	Condition EXPRESSION_NODE
 	Then, Els []STATEMENT_NODE
 	Position
+	End Position
+	// position right after the "}" of the THEN branch
+	ThenEnd Position
 }
 
 func (s *IF_STATEMENT) statementNode()        {}
 func (s *IF_STATEMENT) GetPosition() Position { return s.Position }
+func (s *IF_STATEMENT) GetEnd() Position      { return s.End }
+func (s *IF_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type SAY_STATEMENT struct {
 	Expression EXPRESSION_NODE
 	Position
+	End Position
 }
 
 func (s *SAY_STATEMENT) statementNode()        {}
 func (s *SAY_STATEMENT) GetPosition() Position { return s.Position }
+func (s *SAY_STATEMENT) GetEnd() Position      { return s.End }
+func (s *SAY_STATEMENT) setEnd(end Position)   { s.End = end }
 
 type EXPRESSION_STATEMENT struct {
 	Expression EXPRESSION_NODE
 	Position
+	End Position
 }
 
 func (s *EXPRESSION_STATEMENT) statementNode()        {}
 func (s *EXPRESSION_STATEMENT) GetPosition() Position { return s.Position }
+func (s *EXPRESSION_STATEMENT) GetEnd() Position      { return s.End }
+func (s *EXPRESSION_STATEMENT) setEnd(end Position)   { s.End = end }
+
+// stands in for a statement that failed to parse, see Parser.Recover
+type ERROR_STATEMENT struct {
+	Err *ScriptError
+	Position
+	End Position
+}
+
+func (s *ERROR_STATEMENT) statementNode()        {}
+func (s *ERROR_STATEMENT) GetPosition() Position { return s.Position }
+func (s *ERROR_STATEMENT) GetEnd() Position      { return s.End }
+func (s *ERROR_STATEMENT) setEnd(end Position)   { s.End = end }
 
 // EXPRESSIONS:
 
 type BINARY_EXPRESSION struct {
 	Operator    string
 	Left, Right EXPRESSION_NODE
+	Span
 }
 
 func (s *BINARY_EXPRESSION) expressionNode() {}
+func (s *BINARY_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type BINARY_ASSIGN_EXPRESSION struct {
 	Operator, Left string
-	Right          EXPRESSION_NODE
+	// where Left is written
+	Name  Span
+	Right EXPRESSION_NODE
+	Span
 }
 
 func (s *BINARY_ASSIGN_EXPRESSION) expressionNode() {}
+func (s *BINARY_ASSIGN_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type UNARY_OPERATION_EXPRESSION struct {
 	Operator   string
 	Expression EXPRESSION_NODE
+	Span
 }
 
 func (s *UNARY_OPERATION_EXPRESSION) expressionNode() {}
+func (s *UNARY_OPERATION_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type VARIABLE_EXPRESSION struct {
 	Identifier string
+	Span
 }
 
 func (s *VARIABLE_EXPRESSION) expressionNode() {}
+func (s *VARIABLE_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type PRIMITIVE_LITERAL_EXPRESSION struct {
 	Value interface{}
+	// the literal as written, e.g. 0xFF or 1_000
+	Raw string
+	Span
 }
 
 func (s *PRIMITIVE_LITERAL_EXPRESSION) expressionNode() {}
+func (s *PRIMITIVE_LITERAL_EXPRESSION) GetSpan() Span   { return s.Span }
 
-type NULL_EXPRESSION struct{}
+type NULL_EXPRESSION struct {
+	Span
+}
 
 func (s *NULL_EXPRESSION) expressionNode() {}
+func (s *NULL_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type FUNCTIONAL_EXPRESSION struct {
 	Identifier string
+	Name       Span
 	Args       []string
-	Body       []STATEMENT_NODE
+	// where each of Args is written
+	Params []Span
+	Body   []STATEMENT_NODE
+	Doc    string
+	// written as "lambda args: expression", Body is a single RETURN
+	Lambda bool
+	Span
 }
 
 func (s *FUNCTIONAL_EXPRESSION) expressionNode() {}
+func (s *FUNCTIONAL_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type FUNCTION_CALL_EXPRESSION struct {
 	Callable EXPRESSION_NODE
 	Args     []EXPRESSION_NODE
+	Span
 }
 
 func (s *FUNCTION_CALL_EXPRESSION) expressionNode() {}
+func (s *FUNCTION_CALL_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type ARRAY_EXPRESSION struct {
 	Expressions []EXPRESSION_NODE
+	Span
 }
 
 func (s *ARRAY_EXPRESSION) expressionNode() {}
+func (s *ARRAY_EXPRESSION) GetSpan() Span   { return s.Span }
 
 type INDEX_OPERATOR_EXPRESSION struct {
 	Array EXPRESSION_NODE
 	Index EXPRESSION_NODE
+	Span
 }
 
 func (s *INDEX_OPERATOR_EXPRESSION) expressionNode() {}
+func (s *INDEX_OPERATOR_EXPRESSION) GetSpan() Span   { return s.Span }
 
 /*
 type LAMBDA_EXPRESSION struct {
@@ -22,6 +22,25 @@ func (self *LexerBuffer) Peek() rune {
 	return self.input[self.position]
 }
 
+// index of the next rune in the input
+func (self *LexerBuffer) Offset() int {
+	return self.position
+}
+
+// the input between two offsets
+func (self *LexerBuffer) Slice(from, to int) string {
+	return string(self.input[from:to])
+}
+
+// looks ahead without consuming, PeekAt(0) is the same as Peek()
+func (self *LexerBuffer) PeekAt(offset int) rune {
+	if self.position+offset >= len(self.input) {
+		return rune(0)
+	}
+
+	return self.input[self.position+offset]
+}
+
 func (self *LexerBuffer) Next() rune {
 	if self.position >= len(self.input) {
 		return rune(0)
@@ -0,0 +1,324 @@
+package core
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// registry of native functions grouped by the capability they need,
+// global scopes made by MakeScope start with the ones the policy grants
+var Builtins = make(map[Capability]map[string]BUILTIN)
+
+func RegisterBuiltin(capability Capability, name string, fn BuiltinFunction) {
+	if Builtins[capability] == nil {
+		Builtins[capability] = make(map[string]BUILTIN)
+	}
+	Builtins[capability][name] = BUILTIN{name, fn}
+}
+
+func init() {
+	RegisterBuiltin(CORE_CAPABILITY, "len", builtinLen)
+	RegisterBuiltin(CORE_CAPABILITY, "type", builtinType)
+	RegisterBuiltin(CORE_CAPABILITY, "str", builtinStr)
+	RegisterBuiltin(CORE_CAPABILITY, "int", builtinInt)
+	RegisterBuiltin(CORE_CAPABILITY, "float", builtinFloat)
+	RegisterBuiltin(CORE_CAPABILITY, "bool", builtinBool)
+	RegisterBuiltin(CORE_CAPABILITY, "push", builtinPush)
+	RegisterBuiltin(CORE_CAPABILITY, "pop", builtinPop)
+	RegisterBuiltin(CORE_CAPABILITY, "keys", builtinKeys)
+	RegisterBuiltin(CORE_CAPABILITY, "range", builtinRange)
+	RegisterBuiltin(CORE_CAPABILITY, "exit", builtinExit)
+
+	RegisterBuiltin(IO_CAPABILITY, "print", builtinPrint)
+	RegisterBuiltin(IO_CAPABILITY, "input", builtinInput)
+	RegisterBuiltin(IO_CAPABILITY, "readline", builtinReadline)
+}
+
+// ExitError stops the script with a status code, it is returned by
+// exit(code). Hosts find it with errors.As
+type ExitError struct {
+	Code int
+}
+
+func (self *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", self.Code)
+}
+
+// checks that min <= len(args) <= max, max < 0 means no upper bound
+func CheckArgs(name string, args []Object, min, max int) error {
+	if len(args) >= min && (max < 0 || len(args) <= max) {
+		return nil
+	}
+	expected := fmt.Sprintf("%d", min)
+	if max < 0 {
+		expected = fmt.Sprintf("at least %d", min)
+	} else if max != min {
+		expected = fmt.Sprintf("%d to %d", min, max)
+	}
+	return RuntimeError(ARGUMENT_COUNT_CODE, "%s: expected %s args, found %d args",
+		name, expected, len(args))
+}
+
+func ArgTypeError(name string, arg Object) error {
+	return RuntimeError(TYPE_ERROR_CODE, "%s: unsupported argument of type %s",
+		name, Typeof(arg))
+}
+
+func ArgValueError(name string, arg Object, expected string) error {
+	return RuntimeError(ARGUMENT_VALUE_CODE, "%s: argument %s is not %s",
+		name, arg.ToString(), expected)
+}
+
+func builtinLen(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("len", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case ARRAY:
+		return INT(len(t)), nil
+	case STRING:
+		return INT(utf8.RuneCountInString(string(t))), nil
+	case MAP:
+		return INT(len(t)), nil
+	default:
+		return nil, ArgTypeError("len", t)
+	}
+}
+
+func builtinType(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("type", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return STRING(Typeof(args[0])), nil
+}
+
+func builtinStr(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("str", args, 1, 1); err != nil {
+		return nil, err
+	}
+	str := args[0].ToString()
+	if err := interpreter.Allocate(StringSize(len(str))); err != nil {
+		return nil, err
+	}
+	return STRING(str), nil
+}
+
+func builtinInt(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("int", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return ToIntegerObject(args[0])
+}
+
+func builtinFloat(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("float", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return args[0].ToFloating()
+}
+
+func builtinBool(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("bool", args, 1, 1); err != nil {
+		return nil, err
+	}
+	return args[0].ToBoolean()
+}
+
+// arrays are values, so push returns a new array: arr = push(arr, 1, 2)
+func builtinPush(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("push", args, 1, -1); err != nil {
+		return nil, err
+	}
+	arr, ok := args[0].(ARRAY)
+	if !ok {
+		return nil, ArgTypeError("push", args[0])
+	}
+	if err := interpreter.Allocate(ArraySize(len(arr) + len(args) - 1)); err != nil {
+		return nil, err
+	}
+	result := make(ARRAY, 0, len(arr)+len(args)-1)
+	return append(append(result, arr...), args[1:]...), nil
+}
+
+// returns the last element of arr. Arrays are values, so arr itself
+// keeps the element: x = pop(arr)
+func builtinPop(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("pop", args, 1, 1); err != nil {
+		return nil, err
+	}
+	arr, ok := args[0].(ARRAY)
+	if !ok {
+		return nil, ArgTypeError("pop", args[0])
+	}
+	if len(arr) == 0 {
+		return nil, ArgValueError("pop", arr, "a non-empty array")
+	}
+	return arr[len(arr)-1], nil
+}
+
+func builtinKeys(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("keys", args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch t := args[0].(type) {
+	case ARRAY:
+		if err := interpreter.Allocate(ArraySize(len(t))); err != nil {
+			return nil, err
+		}
+		result := make(ARRAY, len(t))
+		for i := range t {
+			result[i] = INT(i)
+		}
+		return result, nil
+	case MAP:
+		if err := interpreter.Allocate(ArraySize(len(t))); err != nil {
+			return nil, err
+		}
+		result := ARRAY{}
+		for _, key := range t.Keys() {
+			result = append(result, STRING(key))
+		}
+		return result, nil
+	default:
+		return nil, ArgTypeError("keys", t)
+	}
+}
+
+// longest array range builds, a larger one fails instead of running
+// the process out of memory when there is no allocation budget
+const MAX_RANGE_LENGTH = 1 << 24
+
+// range(stop), range(start, stop) or range(start, stop, step)
+func builtinRange(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("range", args, 1, 3); err != nil {
+		return nil, err
+	}
+	bounds := make([]INT, len(args))
+	for i, arg := range args {
+		val, ok := arg.(INT)
+		if !ok {
+			return nil, ArgTypeError("range", arg)
+		}
+		bounds[i] = val
+	}
+
+	start, stop, step := INT(0), bounds[0], INT(1)
+	if len(bounds) > 1 {
+		start, stop = bounds[0], bounds[1]
+	}
+	if len(bounds) > 2 {
+		step = bounds[2]
+	}
+	if step == 0 {
+		return nil, errors.New("range: step must not be zero")
+	}
+
+	// number of elements, computed in uint64 so that wide ranges do not overflow
+	distance, stride := uint64(0), uint64(1)
+	if step > 0 && start < stop {
+		distance, stride = uint64(stop)-uint64(start), uint64(step)
+	} else if step < 0 && start > stop {
+		distance, stride = uint64(start)-uint64(stop), -uint64(step)
+	}
+	count := distance / stride
+	if distance%stride != 0 {
+		count++
+	}
+	if count > MAX_RANGE_LENGTH {
+		return nil, fmt.Errorf("%w: range of %d elements, maximum is %d", ErrMemoryLimitExceeded, count, MAX_RANGE_LENGTH)
+	}
+	if err := interpreter.Allocate(ArraySize(int(count))); err != nil {
+		return nil, err
+	}
+
+	result := make(ARRAY, 0, count)
+	for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+		result = append(result, i)
+	}
+	return result, nil
+}
+
+// exit(code) stops the script, code is from 0 to 255 and defaults to 0
+func builtinExit(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("exit", args, 0, 1); err != nil {
+		return nil, err
+	}
+	code := INT(0)
+	if len(args) == 1 {
+		val, ok := args[0].(INT)
+		_, big := args[0].(BIGINT)
+		if !ok && !big {
+			return nil, ArgTypeError("exit", args[0])
+		}
+		// what a process can exit with everywhere
+		if big || val < 0 || val > 255 {
+			return nil, ArgValueError("exit", args[0], "a status code from 0 to 255")
+		}
+		code = val
+	}
+	return nil, &ExitError{int(code)}
+}
+
+func builtinPrint(interpreter *Interpreter, args []Object) (Object, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		strs[i] = arg.ToString()
+	}
+	if _, err := fmt.Fprintln(interpreter.Stdout(), strings.Join(strs, " ")); err != nil {
+		return nil, err
+	}
+	return NULL{}, nil
+}
+
+// input(prompt) writes the optional prompt and reads a line
+func builtinInput(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("input", args, 0, 1); err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		if _, err := fmt.Fprint(interpreter.Stdout(), args[0].ToString()); err != nil {
+			return nil, err
+		}
+	}
+	return ReadLine(interpreter)
+}
+
+func builtinReadline(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("readline", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return ReadLine(interpreter)
+}
+
+// reads a line from stdin without the line break, NULL at the end of
+// input. The line is counted against the allocation budget as it is read
+func ReadLine(interpreter *Interpreter) (Object, error) {
+	if err := interpreter.Allocate(STRING_SIZE); err != nil {
+		return nil, err
+	}
+	var line strings.Builder
+	for {
+		chunk, err := interpreter.Stdin().ReadSlice('\n')
+		if allocErr := interpreter.Allocate(len(chunk)); allocErr != nil {
+			return nil, allocErr
+		}
+		line.Write(chunk)
+		if err == io.EOF {
+			if line.Len() == 0 {
+				return NULL{}, nil
+			}
+			break
+		} else if err == bufio.ErrBufferFull {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		break
+	}
+	text := strings.TrimSuffix(line.String(), "\n")
+	return STRING(strings.TrimSuffix(text, "\r")), nil
+}
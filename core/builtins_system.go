@@ -0,0 +1,274 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// builtins touching the host system, each group is granted by a Policy
+
+func init() {
+	RegisterBuiltin(FS_CAPABILITY, "read_file", builtinReadFile)
+	RegisterBuiltin(FS_CAPABILITY, "write_file", builtinWriteFile)
+	RegisterBuiltin(FS_CAPABILITY, "list_dir", builtinListDir)
+	RegisterBuiltin(FS_CAPABILITY, "exists", builtinExists)
+	RegisterBuiltin(FS_CAPABILITY, "remove", builtinRemove)
+
+	RegisterBuiltin(ENV_CAPABILITY, "getenv", builtinGetenv)
+	RegisterBuiltin(ENV_CAPABILITY, "setenv", builtinSetenv)
+
+	RegisterBuiltin(PROCESS_CAPABILITY, "exec", builtinExec)
+}
+
+// checks that all args are STRINGs
+func StringArgs(name string, args []Object) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, ok := arg.(STRING)
+		if !ok {
+			return nil, ArgTypeError(name, arg)
+		}
+		strs[i] = string(str)
+	}
+	return strs, nil
+}
+
+func builtinReadFile(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("read_file", args, 1, 1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("read_file", args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := interpreter.Policy().CheckPath(strs[0], false)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	// the size of devices, pipes and /proc files is unknown, so what is
+	// read is counted, and one byte past the budget is enough to fail
+	var reader io.Reader = file
+	if remaining := interpreter.RemainingAllocation(); remaining >= 0 {
+		reader = io.LimitReader(file, int64(remaining)+1)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := interpreter.Allocate(StringSize(len(data))); err != nil {
+		return nil, err
+	}
+	return STRING(data), nil
+}
+
+func builtinWriteFile(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("write_file", args, 2, 2); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("write_file", args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := interpreter.Policy().CheckPath(strs[0], true)
+	if err != nil {
+		return nil, err
+	}
+	return NULL{}, ioutil.WriteFile(path, []byte(strs[1]), 0666)
+}
+
+func builtinListDir(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("list_dir", args, 1, 1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("list_dir", args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := interpreter.Policy().CheckPath(strs[0], false)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	size := ArraySize(len(entries))
+	for _, entry := range entries {
+		size += StringSize(len(entry.Name()))
+	}
+	if err := interpreter.Allocate(size); err != nil {
+		return nil, err
+	}
+	result := make(ARRAY, len(entries))
+	for i, entry := range entries {
+		result[i] = STRING(entry.Name())
+	}
+	return result, nil
+}
+
+func builtinExists(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("exists", args, 1, 1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("exists", args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := interpreter.Policy().CheckPath(strs[0], false)
+	if err != nil {
+		return nil, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return BOOL(false), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return BOOL(true), nil
+}
+
+func builtinRemove(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("remove", args, 1, 1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("remove", args)
+	if err != nil {
+		return nil, err
+	}
+	path, err := interpreter.Policy().CheckPath(strs[0], true)
+	if err != nil {
+		return nil, err
+	}
+	return NULL{}, os.Remove(path)
+}
+
+// getenv(name) returns NULL for unset variables
+func builtinGetenv(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("getenv", args, 1, 1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("getenv", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := interpreter.Policy().CheckEnv(strs[0]); err != nil {
+		return nil, err
+	}
+	if val, ok := interpreter.Getenv(strs[0]); ok {
+		return STRING(val), nil
+	}
+	return NULL{}, nil
+}
+
+// setenv(name, value) changes the environment of the interpreter and of
+// the commands it runs, not the one of the host process
+func builtinSetenv(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("setenv", args, 2, 2); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("setenv", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := interpreter.Policy().CheckEnv(strs[0]); err != nil {
+		return nil, err
+	}
+	interpreter.Setenv(strs[0], strs[1])
+	return NULL{}, nil
+}
+
+// the variable from setenv, or else from the process environment
+func (self *Interpreter) Getenv(name string) (string, bool) {
+	if val, ok := self.env[name]; ok {
+		return val, true
+	}
+	return os.LookupEnv(name)
+}
+
+// sets a variable for this interpreter only, see Environ
+func (self *Interpreter) Setenv(name, value string) {
+	if self.env == nil {
+		self.env = make(map[string]string)
+	}
+	self.env[name] = value
+}
+
+// the process environment with the variables from setenv, as "key=value"
+func (self *Interpreter) Environ() []string {
+	environ := []string{}
+	for _, entry := range os.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if _, ok := self.env[name]; !ok {
+			environ = append(environ, entry)
+		}
+	}
+	for name, value := range self.env {
+		environ = append(environ, name+"="+value)
+	}
+	return environ
+}
+
+// exec(command, args...) runs a command and returns its standard output,
+// its standard error goes to the interpreter stderr
+func builtinExec(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("exec", args, 1, -1); err != nil {
+		return nil, err
+	}
+	strs, err := StringArgs("exec", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := interpreter.Policy().CheckCommand(strs[0]); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(interpreter.Context())
+	defer cancel()
+	stdout := &allocatingWriter{interpreter: interpreter, cancel: cancel}
+	command := exec.CommandContext(ctx, strs[0], strs[1:]...)
+	command.Env = interpreter.Environ()
+	command.Stdout = stdout
+	command.Stderr = interpreter.Stderr()
+	err = command.Run()
+	if stdout.err != nil {
+		return nil, stdout.err
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("exec %s: %s", strs[0], err))
+	}
+	if err := interpreter.Allocate(STRING_SIZE); err != nil {
+		return nil, err
+	}
+	return STRING(stdout.buffer.String()), nil
+}
+
+// the standard output of a command, counted against the allocation budget
+// as it arrives. Past the budget the command is killed
+type allocatingWriter struct {
+	interpreter *Interpreter
+	buffer      bytes.Buffer
+	cancel      context.CancelFunc
+	err         error
+}
+
+func (self *allocatingWriter) Write(data []byte) (int, error) {
+	if err := self.interpreter.Allocate(len(data)); err != nil {
+		self.err = err
+		self.cancel()
+		return 0, err
+	}
+	return self.buffer.Write(data)
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExit(t *testing.T) {
+	tests := []struct {
+		source string
+		status int
+		code   string
+	}{
+		{"exit()", 0, ""},
+		{"exit(0)", 0, ""},
+		{"exit(3)", 3, ""},
+		{"exit(255)", 255, ""},
+		{"exit(256)", 0, ARGUMENT_VALUE_CODE},
+		{"exit(-1)", 0, ARGUMENT_VALUE_CODE},
+		{"exit(99999999999999999999)", 0, ARGUMENT_VALUE_CODE},
+		{"exit(\"1\")", 0, TYPE_ERROR_CODE},
+		{"exit(1, 2)", 0, ARGUMENT_COUNT_CODE},
+	}
+	for _, test := range tests {
+		_, err := runScript(t, test.source)
+		var exitErr *ExitError
+		if test.code == "" {
+			if !errors.As(err, &exitErr) || exitErr.Code != test.status {
+				t.Errorf("%s failed with %v, want exit status %d", test.source, err, test.status)
+			}
+			continue
+		}
+		var scriptErr *ScriptError
+		if !errors.As(err, &scriptErr) || scriptErr.Code != test.code {
+			t.Errorf("%s failed with %v, want %s", test.source, err, test.code)
+		}
+	}
+}
+
+func TestArrayBuiltins(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		{"say push([1], 2, 3)", "[1, 2, 3]", ""},
+		{"let a = [1]\nlet b = push(a, 2)\nsay a\nsay b", "[1]\n[1, 2]", ""},
+		{"let a = [1, 2]\nsay pop(a)\nsay a", "2\n[1, 2]", ""},
+		{"say pop([])", "", ARGUMENT_VALUE_CODE},
+		{"say pop(1)", "", TYPE_ERROR_CODE},
+		{"say keys([4, 5])", "[0, 1]", ""},
+		{"say range(3)", "[0, 1, 2]", ""},
+		{"say range(2, 5)", "[2, 3, 4]", ""},
+		{"say range(5, 0, -2)", "[5, 3, 1]", ""},
+		{"say range(3, 1)", "[]", ""},
+		{"say range(0, 1, 0)", "", RUNTIME_ERROR_CODE},
+		// fails before allocating anything
+		{"say range(1000000000000)", "", MEMORY_LIMIT_CODE},
+		{"say range(-9223372036854775807, 9223372036854775807, 9223372036854775807)", "[-9223372036854775807, 0]", ""},
+	})
+}
+
+func TestInputStreams(t *testing.T) {
+	source := "let name = input(\"name? \")\nsay \"hello \" + name\nprint(readline(), readline())\nsay readline()"
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	interpreter := NewInterpreter()
+	interpreter.SetStdin(strings.NewReader("ada\r\nlast\nline"))
+	interpreter.SetStdout(&output)
+	if err := interpreter.Interpret(context.Background(), program); err != nil {
+		t.Fatal(err)
+	}
+	// the line breaks are dropped and the end of input reads as null
+	want := "name? hello ada\nlast line\nnull\n"
+	if output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
@@ -0,0 +1,471 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+// Conversions between Go values and Objects.
+//
+// Go to Object: nil -> NULL, bool -> BOOL, integers -> INT (or BIGINT),
+// floats -> FLOAT, string -> STRING, *big.Int -> INT/BIGINT,
+// *big.Rat -> RATIONAL, slices and arrays -> ARRAY, maps with string keys
+// and structs -> MAP, functions -> BUILTIN, see WrapFunc.
+// Struct fields are named by the `script:"name"` tag or by the field name,
+// `script:"-"` skips a field.
+
+var (
+	objectType      = reflect.TypeOf((*Object)(nil)).Elem()
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	interpreterType = reflect.TypeOf((*Interpreter)(nil))
+	bigIntType      = reflect.TypeOf((*big.Int)(nil))
+	bigRatType      = reflect.TypeOf((*big.Rat)(nil))
+)
+
+func ToObject(value interface{}) (Object, error) {
+	if value == nil {
+		return NULL{}, nil
+	}
+	if obj, ok := value.(Object); ok {
+		return obj, nil
+	}
+	return toObject(reflect.ValueOf(value))
+}
+
+func toObject(value reflect.Value) (Object, error) {
+	if !value.IsValid() {
+		return NULL{}, nil
+	}
+	if value.Type().Implements(objectType) && value.CanInterface() {
+		if value.Kind() == reflect.Interface && value.IsNil() {
+			return NULL{}, nil
+		}
+		return value.Interface().(Object), nil
+	}
+
+	switch value.Type() {
+	case bigIntType:
+		if value.IsNil() {
+			return NULL{}, nil
+		}
+		return NormalizeInteger(new(big.Int).Set(value.Interface().(*big.Int))), nil
+	case bigRatType:
+		if value.IsNil() {
+			return NULL{}, nil
+		}
+		return RATIONAL{new(big.Rat).Set(value.Interface().(*big.Rat))}, nil
+	}
+
+	switch value.Kind() {
+	case reflect.Bool:
+		return BOOL(value.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NormalizeInteger(big.NewInt(value.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NormalizeInteger(new(big.Int).SetUint64(value.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return FLOAT(value.Float()), nil
+	case reflect.String:
+		return STRING(value.String()), nil
+	case reflect.Interface, reflect.Ptr:
+		if value.IsNil() {
+			return NULL{}, nil
+		}
+		return toObject(value.Elem())
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return NULL{}, nil
+		}
+		result := make(ARRAY, value.Len())
+		for i := range result {
+			obj, err := toObject(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			result[i] = obj
+		}
+		return result, nil
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			return nil, errors.New(fmt.Sprintf("cannot convert %s to MAP: keys must be strings",
+				value.Type()))
+		}
+		if value.IsNil() {
+			return NULL{}, nil
+		}
+		result := make(MAP, value.Len())
+		iter := value.MapRange()
+		for iter.Next() {
+			obj, err := toObject(iter.Value())
+			if err != nil {
+				return nil, err
+			}
+			result[iter.Key().String()] = obj
+		}
+		return result, nil
+	case reflect.Struct:
+		result := make(MAP)
+		for i := 0; i < value.NumField(); i++ {
+			name, ok := fieldName(value.Type().Field(i))
+			if !ok {
+				continue
+			}
+			obj, err := toObject(value.Field(i))
+			if err != nil {
+				return nil, err
+			}
+			result[name] = obj
+		}
+		return result, nil
+	case reflect.Func:
+		if value.IsNil() {
+			return NULL{}, nil
+		}
+		return WrapFunc("function", value.Interface())
+	default:
+		return nil, errors.New(fmt.Sprintf("cannot convert %s to object", value.Type()))
+	}
+}
+
+// name of an exported struct field as seen by scripts
+func fieldName(field reflect.StructField) (string, bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("script")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+// FromObject converts obj to the natural Go value: NULL -> nil, BOOL -> bool,
+// INT -> int, BIGINT -> *big.Int, RATIONAL -> *big.Rat, FLOAT -> float64,
+// STRING -> string, ARRAY -> []interface{}, MAP -> map[string]interface{},
+// other objects are returned as they are
+func FromObject(obj Object) interface{} {
+	switch t := obj.(type) {
+	case NULL:
+		return nil
+	case BOOL:
+		return bool(t)
+	case INT:
+		return int(t)
+	case BIGINT:
+		return new(big.Int).Set(t.Value)
+	case RATIONAL:
+		return new(big.Rat).Set(t.Value)
+	case FLOAT:
+		return float64(t)
+	case STRING:
+		return string(t)
+	case ARRAY:
+		result := make([]interface{}, len(t))
+		for i, val := range t {
+			result[i] = FromObject(val)
+		}
+		return result
+	case MAP:
+		result := make(map[string]interface{}, len(t))
+		for key, val := range t {
+			result[key] = FromObject(val)
+		}
+		return result
+	default:
+		return obj
+	}
+}
+
+// DecodeObject stores obj into the Go value target points to,
+// script functions can be decoded into Go func types whose last result
+// is an error
+func (self *Interpreter) DecodeObject(obj Object, target interface{}) error {
+	ptr := reflect.ValueOf(target)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() {
+		return errors.New("DecodeObject: target must be a non-nil pointer")
+	}
+	value, err := self.convertObject(obj, ptr.Type().Elem())
+	if err != nil {
+		return err
+	}
+	ptr.Elem().Set(value)
+	return nil
+}
+
+func conversionError(obj Object, target reflect.Type) error {
+	return errors.New(fmt.Sprintf("cannot convert %s to %s", Typeof(obj), target))
+}
+
+func (self *Interpreter) convertObject(obj Object, target reflect.Type) (reflect.Value, error) {
+	if target.Kind() == reflect.Interface && target.NumMethod() == 0 {
+		result := reflect.New(target).Elem()
+		if val := FromObject(obj); val != nil {
+			result.Set(reflect.ValueOf(val))
+		}
+		return result, nil
+	}
+	if reflect.TypeOf(obj).AssignableTo(target) {
+		return reflect.ValueOf(obj), nil
+	}
+
+	switch target {
+	case bigIntType:
+		if !IsInteger(obj) {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		return reflect.ValueOf(new(big.Int).Set(toBigInt(obj))), nil
+	case bigRatType:
+		if !IsNumber(obj) || obj.Typeof() == FLOATING_TYPE {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		return reflect.ValueOf(new(big.Rat).Set(toRat(obj))), nil
+	}
+
+	result := reflect.New(target).Elem()
+	switch target.Kind() {
+	case reflect.Bool:
+		val, ok := obj.(BOOL)
+		if !ok {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.SetBool(bool(val))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !IsInteger(obj) || !toBigInt(obj).IsInt64() || result.OverflowInt(toBigInt(obj).Int64()) {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.SetInt(toBigInt(obj).Int64())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if !IsInteger(obj) || !toBigInt(obj).IsUint64() || result.OverflowUint(toBigInt(obj).Uint64()) {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.SetUint(toBigInt(obj).Uint64())
+	case reflect.Float32, reflect.Float64:
+		if !IsNumber(obj) {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.SetFloat(toFloat(obj))
+	case reflect.String:
+		val, ok := obj.(STRING)
+		if !ok {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.SetString(string(val))
+	case reflect.Ptr:
+		if obj.Typeof() == NULL_TYPE {
+			return result, nil
+		}
+		elem, err := self.convertObject(obj, target.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result.Set(reflect.New(target.Elem()))
+		result.Elem().Set(elem)
+	case reflect.Slice:
+		if obj.Typeof() == NULL_TYPE {
+			return result, nil
+		}
+		arr, ok := obj.(ARRAY)
+		if !ok {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.Set(reflect.MakeSlice(target, len(arr), len(arr)))
+		for i, val := range arr {
+			elem, err := self.convertObject(val, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(i).Set(elem)
+		}
+	case reflect.Array:
+		arr, ok := obj.(ARRAY)
+		if !ok || len(arr) != target.Len() {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		for i, val := range arr {
+			elem, err := self.convertObject(val, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(i).Set(elem)
+		}
+	case reflect.Map:
+		if obj.Typeof() == NULL_TYPE {
+			return result, nil
+		}
+		m, ok := obj.(MAP)
+		if !ok || target.Key().Kind() != reflect.String {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		result.Set(reflect.MakeMapWithSize(target, len(m)))
+		for key, val := range m {
+			elem, err := self.convertObject(val, target.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(reflect.ValueOf(key).Convert(target.Key()), elem)
+		}
+	case reflect.Struct:
+		m, ok := obj.(MAP)
+		if !ok {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		for i := 0; i < target.NumField(); i++ {
+			name, ok := fieldName(target.Field(i))
+			if !ok {
+				continue
+			}
+			val, ok := m[name]
+			if !ok {
+				continue
+			}
+			field, err := self.convertObject(val, target.Field(i).Type)
+			if err != nil {
+				return reflect.Value{}, errors.New(fmt.Sprintf("field %s: %s", name, err))
+			}
+			result.Field(i).Set(field)
+		}
+	case reflect.Func:
+		fn, ok := obj.(CALLABLE)
+		if !ok {
+			return reflect.Value{}, conversionError(obj, target)
+		}
+		return self.makeGoFunc(fn, target)
+	default:
+		return reflect.Value{}, conversionError(obj, target)
+	}
+	return result, nil
+}
+
+// wraps a script function into a Go function of the given type. Script
+// calls can fail, so the last result must be an error, and at most one
+// value may come before it
+func (self *Interpreter) makeGoFunc(fn CALLABLE, target reflect.Type) (reflect.Value, error) {
+	if target.NumOut() == 0 || target.Out(target.NumOut()-1) != errorType {
+		return reflect.Value{}, errors.New(fmt.Sprintf(
+			"cannot convert FUNCTION to %s: the last result must be an error", target))
+	}
+	values := target.NumOut() - 1
+	if values > 1 {
+		return reflect.Value{}, errors.New(fmt.Sprintf(
+			"cannot convert FUNCTION to %s: at most one result besides error is supported", target))
+	}
+
+	return reflect.MakeFunc(target, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, target.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(target.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+			return out
+		}
+
+		args := make([]Object, len(in))
+		for i, val := range in {
+			obj, err := toObject(val)
+			if err != nil {
+				return fail(err)
+			}
+			args[i] = obj
+		}
+		// a call from a builtin shares the limits of the running script,
+		// a call from the host starts a run of its own
+		var result Object
+		err := self.run(context.Background(), func() error {
+			obj, err := fn.Call(self, args)
+			result = obj
+			return err
+		})
+		if err != nil {
+			return fail(err)
+		}
+		if values == 1 {
+			val, err := self.convertObject(result, target.Out(0))
+			if err != nil {
+				return fail(err)
+			}
+			out[0] = val
+		}
+		return out
+	}), nil
+}
+
+// WrapFunc turns a Go function into a BUILTIN, converting arguments and
+// results automatically. The function may take *Interpreter as its first
+// parameter, be variadic, and return nothing, a value, an error,
+// or a value and an error
+func WrapFunc(name string, fn interface{}) (BUILTIN, error) {
+	switch t := fn.(type) {
+	case BuiltinFunction:
+		return BUILTIN{name, t}, nil
+	case func(*Interpreter, []Object) (Object, error):
+		return BUILTIN{name, t}, nil
+	}
+
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return BUILTIN{}, errors.New(fmt.Sprintf("%s: expected a function, found %T", name, fn))
+	}
+	fnType := value.Type()
+	returnsErr := fnType.NumOut() > 0 && fnType.Out(fnType.NumOut()-1) == errorType
+	values := fnType.NumOut()
+	if returnsErr {
+		values--
+	}
+	if values > 1 {
+		return BUILTIN{}, errors.New(fmt.Sprintf(
+			"%s: at most one result besides error is supported", name))
+	}
+	withInterpreter := fnType.NumIn() > 0 && fnType.In(0) == interpreterType
+	params := fnType.NumIn()
+	if withInterpreter {
+		params--
+	}
+
+	call := func(interpreter *Interpreter, args []Object) (Object, error) {
+		if fnType.IsVariadic() {
+			if err := CheckArgs(name, args, params-1, -1); err != nil {
+				return nil, err
+			}
+		} else if err := CheckArgs(name, args, params, params); err != nil {
+			return nil, err
+		}
+
+		in := []reflect.Value{}
+		if withInterpreter {
+			in = append(in, reflect.ValueOf(interpreter))
+		}
+		for i, arg := range args {
+			index := len(in)
+			if fnType.IsVariadic() && index >= fnType.NumIn()-1 {
+				index = fnType.NumIn() - 1
+			}
+			paramType := fnType.In(index)
+			if fnType.IsVariadic() && index == fnType.NumIn()-1 {
+				paramType = paramType.Elem()
+			}
+			val, err := interpreter.convertObject(arg, paramType)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("%s: argument %d: %s", name, i+1, err))
+			}
+			in = append(in, val)
+		}
+
+		out := value.Call(in)
+		if returnsErr && !out[len(out)-1].IsNil() {
+			return nil, out[len(out)-1].Interface().(error)
+		}
+		if values == 0 {
+			return NULL{}, nil
+		}
+		return toObject(out[0])
+	}
+	return BUILTIN{name, call}, nil
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeFunction(t *testing.T) {
+	interpreter := NewInterpreter()
+	fn, err := interpreter.Eval("fn: x { return 10 / x }")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var noError func(int) int
+	if err := interpreter.DecodeObject(fn, &noError); err == nil {
+		t.Error("decoding into func(int) int succeeded, want an error")
+	}
+
+	var divide func(int) (int, error)
+	if err := interpreter.DecodeObject(fn, &divide); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := divide(5); err != nil || result != 2 {
+		t.Errorf("divide(5) = %d, %v, want 2, nil", result, err)
+	}
+	if _, err := divide(0); !errors.Is(err, DIVISION_BY_ZERO_ERROR) {
+		t.Errorf("divide(0) failed with %v, want division by zero", err)
+	}
+}
+
+func TestDecodedFunctionLimits(t *testing.T) {
+	interpreter := NewInterpreter()
+	interpreter.SetTimeout(50 * time.Millisecond)
+	fn, err := interpreter.Eval("fn: { for true {}\nreturn 1 }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loop func() (int, error)
+	if err := interpreter.DecodeObject(fn, &loop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loop(); !errors.Is(err, ErrTimeout) {
+		t.Errorf("loop() failed with %v, want the timeout", err)
+	}
+}
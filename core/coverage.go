@@ -0,0 +1,340 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Coverage counts, while attached to an interpreter, how often each
+// statement of a program runs and which way each IF and FOR condition
+// goes. NewCoverage registers the statements of the program up front, so
+// those that never run are reported too. Statements of other programs,
+// e.g. code evaluated by the debugger, are not counted
+
+// the two ways out of the condition of an IF or FOR statement
+type BranchCoverage struct {
+	Position
+	// "if" or "for"
+	Kind string
+	// times the condition was true, for FOR the times the body ran
+	True int
+	// times it was false, for IF the ELSE branch, even a missing one
+	False int
+}
+
+// the way a branch goes, for messages
+func (self *BranchCoverage) Name(taken bool) string {
+	switch {
+	case self.Kind == "for" && taken:
+		return "body"
+	case self.Kind == "for":
+		return "exit"
+	case taken:
+		return "then"
+	default:
+		return "else"
+	}
+}
+
+type StatementCoverage struct {
+	Position
+	Hits int
+}
+
+// the statements starting on a line, Hits is the most of them
+type LineCoverage struct {
+	Line       int
+	Hits       int
+	Statements int
+	Covered    int
+	// two per IF and FOR, Taken counts those that ran at least once
+	Branches int
+	Taken    int
+}
+
+type CoverageSummary struct {
+	Statements, Covered int
+	Branches, Taken     int
+}
+
+type Coverage struct {
+	statements map[Position]*StatementCoverage
+	branches   map[Position]*BranchCoverage
+}
+
+func NewCoverage(program []STATEMENT_NODE) *Coverage {
+	coverage := &Coverage{
+		statements: make(map[Position]*StatementCoverage),
+		branches:   make(map[Position]*BranchCoverage),
+	}
+	EachStatement(program, func(statement STATEMENT_NODE) {
+		position := statement.GetPosition()
+		coverage.statements[position] = &StatementCoverage{Position: position}
+		switch statement.(type) {
+		case *IF_STATEMENT:
+			coverage.branches[position] = &BranchCoverage{Position: position, Kind: "if"}
+		case *FOR_STATEMENT:
+			coverage.branches[position] = &BranchCoverage{Position: position, Kind: "for"}
+		}
+	})
+	return coverage
+}
+
+// attaches a coverage, nil detaches it
+func (self *Interpreter) SetCoverage(coverage *Coverage) {
+	self.coverage = coverage
+}
+
+// called by EvalStatementList before each statement
+func (self *Coverage) hit(statement STATEMENT_NODE) {
+	if counted, ok := self.statements[statement.GetPosition()]; ok {
+		counted.Hits++
+	}
+}
+
+// called by EvalStatementList with the value of each IF and FOR condition
+func (self *Coverage) branch(statement STATEMENT_NODE, taken bool) {
+	branch, ok := self.branches[statement.GetPosition()]
+	if !ok {
+		return
+	}
+	if taken {
+		branch.True++
+	} else {
+		branch.False++
+	}
+}
+
+// statements in source order
+func (self *Coverage) Statements() []*StatementCoverage {
+	statements := []*StatementCoverage{}
+	for _, statement := range self.statements {
+		statements = append(statements, statement)
+	}
+	sort.Slice(statements, func(i, j int) bool {
+		return Before(statements[i].Position, statements[j].Position)
+	})
+	return statements
+}
+
+// branches in source order
+func (self *Coverage) Branches() []*BranchCoverage {
+	branches := []*BranchCoverage{}
+	for _, branch := range self.branches {
+		branches = append(branches, branch)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		return Before(branches[i].Position, branches[j].Position)
+	})
+	return branches
+}
+
+// the lines where a statement starts, in order
+func (self *Coverage) Lines() []*LineCoverage {
+	lines := []*LineCoverage{}
+	byLine := make(map[int]*LineCoverage)
+	for _, statement := range self.Statements() {
+		line, ok := byLine[statement.Line]
+		if !ok {
+			line = &LineCoverage{Line: statement.Line}
+			byLine[statement.Line] = line
+			lines = append(lines, line)
+		}
+		line.Statements++
+		if statement.Hits > 0 {
+			line.Covered++
+		}
+		if statement.Hits > line.Hits {
+			line.Hits = statement.Hits
+		}
+		if branch, ok := self.branches[statement.Position]; ok {
+			line.Branches += 2
+			for _, count := range []int{branch.True, branch.False} {
+				if count > 0 {
+					line.Taken++
+				}
+			}
+		}
+	}
+	return lines
+}
+
+func (self *Coverage) Summary() CoverageSummary {
+	summary := CoverageSummary{}
+	for _, line := range self.Lines() {
+		summary.Statements += line.Statements
+		summary.Covered += line.Covered
+		summary.Branches += line.Branches
+		summary.Taken += line.Taken
+	}
+	return summary
+}
+
+// percent of the statements that ran, 100 without statements
+func (self CoverageSummary) StatementPercent() float64 {
+	return coveragePercent(self.Covered, self.Statements)
+}
+
+func (self CoverageSummary) BranchPercent() float64 {
+	return coveragePercent(self.Taken, self.Branches)
+}
+
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// writes the percentages, the lines that never ran and the branches
+// never taken, file names the script
+func (self *Coverage) WriteSummary(w io.Writer, file string) {
+	summary := self.Summary()
+	fmt.Fprintf(w, "%s: statements %.1f%% (%d/%d), branches %.1f%% (%d/%d)\n", file,
+		summary.StatementPercent(), summary.Covered, summary.Statements,
+		summary.BranchPercent(), summary.Taken, summary.Branches)
+
+	missed := []int{}
+	for _, line := range self.Lines() {
+		if line.Covered < line.Statements {
+			missed = append(missed, line.Line)
+		}
+	}
+	if len(missed) > 0 {
+		fmt.Fprintf(w, "  lines not run: %s\n", LineRanges(missed))
+	}
+
+	untaken := []string{}
+	for _, branch := range self.Branches() {
+		if self.statements[branch.Position].Hits == 0 {
+			// the line is listed as not run already
+			continue
+		}
+		if branch.True == 0 {
+			untaken = append(untaken, fmt.Sprintf("%d %s", branch.Line, branch.Name(true)))
+		}
+		if branch.False == 0 {
+			untaken = append(untaken, fmt.Sprintf("%d %s", branch.Line, branch.Name(false)))
+		}
+	}
+	if len(untaken) > 0 {
+		fmt.Fprintf(w, "  branches not taken: %s\n", strings.Join(untaken, ", "))
+	}
+}
+
+// sorted lines as "1, 4-6, 9"
+func LineRanges(lines []int) string {
+	ranges := []string{}
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(lines[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", lines[i], lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
+
+// writes the coverage as a record of the LCOV tracefile format, as read
+// by genhtml and most CI services
+func (self *Coverage) WriteLcov(w io.Writer, file string) {
+	fmt.Fprintf(w, "TN:\nSF:%s\n", file)
+	branches, taken := 0, 0
+	blocks := make(map[int]int)
+	for _, branch := range self.Branches() {
+		block := blocks[branch.Line]
+		blocks[branch.Line]++
+		for i, count := range []int{branch.True, branch.False} {
+			branches++
+			if self.statements[branch.Position].Hits == 0 {
+				// the condition never ran
+				fmt.Fprintf(w, "BRDA:%d,%d,%d,-\n", branch.Line, block, i)
+				continue
+			}
+			if count > 0 {
+				taken++
+			}
+			fmt.Fprintf(w, "BRDA:%d,%d,%d,%d\n", branch.Line, block, i, count)
+		}
+	}
+	fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", branches, taken)
+
+	lines, hit := 0, 0
+	for _, line := range self.Lines() {
+		lines++
+		if line.Hits > 0 {
+			hit++
+		}
+		fmt.Fprintf(w, "DA:%d,%d\n", line.Line, line.Hits)
+	}
+	fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", lines, hit)
+}
+
+const COVERAGE_HTML_HEAD = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>coverage of %s</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; font-family: monospace; }
+td { padding: 0 0.6em; white-space: pre; vertical-align: top; }
+td.line, td.hits { text-align: right; color: #888; }
+tr.hit td.source { background: #dfd; }
+tr.partial td.source { background: #ffc; }
+tr.missed td.source { background: #fcc; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<p>statements %.1f%% (%d/%d), branches %.1f%% (%d/%d)</p>
+<table>
+`
+
+const COVERAGE_HTML_TAIL = `</table>
+</body>
+</html>
+`
+
+// writes a page with the source of file, every line with its hits and
+// colored by whether it ran, ran in part or never ran. A line runs in
+// part when some of its statements or branches never ran
+func (self *Coverage) WriteHtml(w io.Writer, file string, source string) {
+	summary := self.Summary()
+	name := html.EscapeString(file)
+	fmt.Fprintf(w, COVERAGE_HTML_HEAD, name, name,
+		summary.StatementPercent(), summary.Covered, summary.Statements,
+		summary.BranchPercent(), summary.Taken, summary.Branches)
+
+	byLine := make(map[int]*LineCoverage)
+	for _, line := range self.Lines() {
+		byLine[line.Line] = line
+	}
+	for i, text := range strings.Split(source, "\n") {
+		class, hits, title := "", "", ""
+		if line, ok := byLine[i+1]; ok {
+			hits = fmt.Sprint(line.Hits)
+			switch {
+			case line.Covered == 0:
+				class = "missed"
+			case line.Covered < line.Statements || line.Taken < line.Branches:
+				class = "partial"
+				title = fmt.Sprintf("%d/%d statements, %d/%d branches",
+					line.Covered, line.Statements, line.Taken, line.Branches)
+			default:
+				class = "hit"
+			}
+		}
+		fmt.Fprintf(w, "<tr class=\"%s\" title=\"%s\"><td class=\"line\">%d</td><td class=\"hits\">%s</td><td class=\"source\">%s</td></tr>\n",
+			class, title, i+1, hits, html.EscapeString(text))
+	}
+	fmt.Fprint(w, COVERAGE_HTML_TAIL)
+}
@@ -0,0 +1,84 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const coveredSource = `fn sign: n {
+    if n < 0 {
+        return -1
+    } else {
+        return 1
+    }
+}
+let i = 0
+for i < 2 {
+    i += 1
+}
+say sign(5) + sign(7)`
+
+func cover(t *testing.T, source string) *Coverage {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(ioutil.Discard)
+	coverage := NewCoverage(program)
+	interpreter.SetCoverage(coverage)
+	if err := interpreter.Interpret(context.Background(), program); err != nil {
+		t.Fatal(err)
+	}
+	return coverage
+}
+
+func TestCoverage(t *testing.T) {
+	coverage := cover(t, coveredSource)
+
+	hits := []string{}
+	for _, statement := range coverage.Statements() {
+		hits = append(hits, fmt.Sprintf("%d:%d", statement.Line, statement.Hits))
+	}
+	// the return of the then branch never ran
+	if want := "1:1 2:2 3:0 5:2 8:1 9:1 10:2 12:1"; strings.Join(hits, " ") != want {
+		t.Errorf("statement hits are %v, want %s", hits, want)
+	}
+
+	branches := []string{}
+	for _, branch := range coverage.Branches() {
+		branches = append(branches, fmt.Sprintf("%s %d: %s %d, %s %d",
+			branch.Kind, branch.Line, branch.Name(true), branch.True, branch.Name(false), branch.False))
+	}
+	if want := "if 2: then 0, else 2; for 9: body 2, exit 1"; strings.Join(branches, "; ") != want {
+		t.Errorf("branches are %v, want %s", branches, want)
+	}
+
+	if summary := coverage.Summary(); summary != (CoverageSummary{8, 7, 4, 3}) {
+		t.Errorf("the summary is %+v", summary)
+	}
+}
+
+func TestWriteLcov(t *testing.T) {
+	var lcov strings.Builder
+	cover(t, coveredSource).WriteLcov(&lcov, "sign.txt")
+	want := "TN:\nSF:sign.txt\n" +
+		"BRDA:2,0,0,0\nBRDA:2,0,1,2\nBRDA:9,0,0,2\nBRDA:9,0,1,1\nBRF:4\nBRH:3\n" +
+		"DA:1,1\nDA:2,2\nDA:3,0\nDA:5,2\nDA:8,1\nDA:9,1\nDA:10,2\nDA:12,1\nLF:8\nLH:7\nend_of_record\n"
+	if lcov.String() != want {
+		t.Errorf("wrote\n%s\nwant\n%s", lcov.String(), want)
+	}
+}
+
+// the branches of a condition that never ran are "-", not 0
+func TestWriteLcovUnreached(t *testing.T) {
+	var lcov strings.Builder
+	cover(t, "fn f: x {\n    if x { return 1 }\n}").WriteLcov(&lcov, "f.txt")
+	if !strings.Contains(lcov.String(), "BRDA:2,0,0,-\nBRDA:2,0,1,-\nBRF:2\nBRH:0\n") {
+		t.Errorf("wrote\n%s", lcov.String())
+	}
+}
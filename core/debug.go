@@ -0,0 +1,400 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Debugger pauses a running interpreter before statements, on
+// breakpoints, after steps and on request. A pause calls the handler on
+// the goroutine running the script, so the handler may inspect the
+// interpreter with the Paused methods until it returns, and it chooses
+// how to go on with Continue, StepIn, StepOver, StepOut or Terminate.
+// Only Pause, SetBreakpoint and ClearBreakpoints may be called from
+// other goroutines
+
+type StepMode int
+
+const (
+	CONTINUE_MODE StepMode = iota
+	// pause at the next statement
+	STEP_IN_MODE
+	// pause at the next statement of the same or an outer call
+	STEP_OVER_MODE
+	// pause at the next statement of an outer call
+	STEP_OUT_MODE
+	TERMINATE_MODE
+)
+
+// why the interpreter paused
+const (
+	ENTRY_REASON      = "entry"
+	BREAKPOINT_REASON = "breakpoint"
+	STEP_REASON       = "step"
+	PAUSE_REASON      = "pause"
+)
+
+type Breakpoint struct {
+	ID   int
+	Line int
+	// source of an expression, the breakpoint only pauses when it is true
+	Condition string
+	condition EXPRESSION_NODE
+	Hits      int
+}
+
+type DebugHandler func(paused *Paused)
+
+type Debugger struct {
+	lock        sync.Mutex
+	breakpoints map[int][]*Breakpoint
+	lastID      int
+	pause       bool
+
+	handler DebugHandler
+	mode    StepMode
+	// number of frames when the step started
+	depth int
+	// conditions and expressions of the handler run without pausing
+	busy bool
+}
+
+// a debugger that pauses before the first statement, see StopOnEntry
+func NewDebugger(handler DebugHandler) *Debugger {
+	return &Debugger{
+		breakpoints: make(map[int][]*Breakpoint),
+		handler:     handler,
+		mode:        STEP_IN_MODE,
+	}
+}
+
+// whether to pause before the first statement, the default
+func (self *Debugger) StopOnEntry(stop bool) {
+	if stop {
+		self.mode = STEP_IN_MODE
+	} else {
+		self.mode = CONTINUE_MODE
+	}
+}
+
+// attaches a debugger, nil detaches it
+func (self *Interpreter) SetDebugger(debugger *Debugger) {
+	self.debugger = debugger
+}
+
+// adds a breakpoint before the statements starting on line, condition
+// is an expression or ""
+func (self *Debugger) SetBreakpoint(line int, condition string) (*Breakpoint, error) {
+	breakpoint := &Breakpoint{Line: line, Condition: condition}
+	if condition != "" {
+		program, err := NewParser(condition).ParseProgram()
+		if err != nil {
+			return nil, err
+		}
+		var statement *EXPRESSION_STATEMENT
+		if len(program) == 1 {
+			statement, _ = program[0].(*EXPRESSION_STATEMENT)
+		}
+		if statement == nil {
+			return nil, NewScriptError(PARSE_ERROR, UNEXPECTED_TOKEN_CODE, "the condition must be one expression")
+		}
+		breakpoint.condition = statement.Expression
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.lastID++
+	breakpoint.ID = self.lastID
+	self.breakpoints[line] = append(self.breakpoints[line], breakpoint)
+	return breakpoint, nil
+}
+
+// removes the breakpoint with id, or all of them for 0
+func (self *Debugger) ClearBreakpoints(id int) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	found := false
+	for line, breakpoints := range self.breakpoints {
+		kept := []*Breakpoint{}
+		for _, breakpoint := range breakpoints {
+			if id != 0 && breakpoint.ID != id {
+				kept = append(kept, breakpoint)
+			} else {
+				found = true
+			}
+		}
+		self.breakpoints[line] = kept
+	}
+	return found
+}
+
+// all breakpoints by line
+func (self *Debugger) Breakpoints() []*Breakpoint {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	breakpoints := []*Breakpoint{}
+	for _, line := range self.breakpoints {
+		breakpoints = append(breakpoints, line...)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool {
+		if breakpoints[i].Line != breakpoints[j].Line {
+			return breakpoints[i].Line < breakpoints[j].Line
+		}
+		return breakpoints[i].ID < breakpoints[j].ID
+	})
+	return breakpoints
+}
+
+// pauses before the next statement
+func (self *Debugger) Pause() {
+	self.lock.Lock()
+	self.pause = true
+	self.lock.Unlock()
+}
+
+// called by EvalStatementList before each statement
+func (self *Debugger) before(interpreter *Interpreter, statement STATEMENT_NODE) error {
+	if self.busy {
+		return nil
+	}
+	if self.mode == TERMINATE_MODE {
+		return fmt.Errorf("%w: terminated by the debugger", ErrCancelled)
+	}
+	depth := len(interpreter.frames)
+	reason := ""
+	switch {
+	case self.mode == STEP_IN_MODE:
+		reason = STEP_REASON
+	case self.mode == STEP_OVER_MODE && depth <= self.depth:
+		reason = STEP_REASON
+	case self.mode == STEP_OUT_MODE && depth < self.depth:
+		reason = STEP_REASON
+	}
+	if interpreter.steps <= 1 && reason != "" {
+		reason = ENTRY_REASON
+	}
+
+	self.lock.Lock()
+	if self.pause {
+		self.pause = false
+		reason = PAUSE_REASON
+	}
+	breakpoints := self.breakpoints[statement.GetPosition().Line]
+	self.lock.Unlock()
+
+	hit := []*Breakpoint{}
+	for _, breakpoint := range breakpoints {
+		if self.conditionHolds(interpreter, breakpoint) {
+			breakpoint.Hits++
+			hit = append(hit, breakpoint)
+		}
+	}
+	if len(hit) > 0 {
+		reason = BREAKPOINT_REASON
+	}
+	if reason == "" {
+		return nil
+	}
+
+	paused := &Paused{Reason: reason, Breakpoints: hit, Statement: statement, debugger: self, interpreter: interpreter}
+	self.mode = CONTINUE_MODE
+	self.handler(paused)
+	self.depth = depth
+	if self.mode == TERMINATE_MODE {
+		return fmt.Errorf("%w: terminated by the debugger", ErrCancelled)
+	}
+	return nil
+}
+
+// a condition failing to evaluate counts as true, so the mistake shows
+func (self *Debugger) conditionHolds(interpreter *Interpreter, breakpoint *Breakpoint) bool {
+	if breakpoint.condition == nil {
+		return true
+	}
+	self.busy = true
+	defer func() { self.busy = false }()
+	value, err := interpreter.EvalExpression(breakpoint.condition)
+	if err != nil {
+		return true
+	}
+	ok, err := value.ToBoolean()
+	return err != nil || bool(ok)
+}
+
+// Paused is the state of an interpreter stopped by its debugger, valid
+// until the handler returns
+type Paused struct {
+	Reason      string
+	Breakpoints []*Breakpoint
+	// the statement about to run
+	Statement   STATEMENT_NODE
+	debugger    *Debugger
+	interpreter *Interpreter
+}
+
+// where execution is in a call, the frame of the innermost call first
+// and the top level last
+type DebugFrame struct {
+	Function string
+	Position Position
+	// innermost scope of the frame
+	Scope *Scope
+}
+
+func (self *Paused) Frames() []DebugFrame {
+	interpreter := self.interpreter
+	frames := []DebugFrame{}
+	position, scope := self.Statement.GetPosition(), interpreter.scope
+	for i := len(interpreter.frames) - 1; i >= 0; i-- {
+		frame := interpreter.frames[i]
+		frames = append(frames, DebugFrame{frame.Function, position, scope})
+		position, scope = frame.CallSite.Start, interpreter.callers[i]
+	}
+	return append(frames, DebugFrame{"<main>", position, scope})
+}
+
+// evaluates code in the scope of frame, the value of a trailing
+// expression is returned. Breakpoints do not pause while it runs
+func (self *Paused) Eval(frame int, code string) (Object, error) {
+	frames := self.Frames()
+	if frame < 0 || frame >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	program, err := NewParser(code).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	interpreter := self.interpreter
+	scope := interpreter.scope
+	interpreter.scope = frames[frame].Scope
+	self.debugger.busy = true
+	defer func() {
+		interpreter.scope = scope
+		self.debugger.busy = false
+	}()
+
+	if len(program) == 1 {
+		if statement, ok := program[0].(*EXPRESSION_STATEMENT); ok {
+			return interpreter.EvalExpression(statement.Expression)
+		}
+	}
+	if _, err := interpreter.EvalStatementList(program); err != nil {
+		return nil, err
+	}
+	return NULL{}, nil
+}
+
+func (self *Paused) Continue() {
+	self.debugger.mode = CONTINUE_MODE
+}
+
+func (self *Paused) StepIn() {
+	self.debugger.mode = STEP_IN_MODE
+}
+
+func (self *Paused) StepOver() {
+	self.debugger.mode = STEP_OVER_MODE
+}
+
+func (self *Paused) StepOut() {
+	self.debugger.mode = STEP_OUT_MODE
+}
+
+// stops the script, Interpret fails with ErrCancelled
+func (self *Paused) Terminate() {
+	self.debugger.mode = TERMINATE_MODE
+}
+
+// the variables of one scope
+type ScopeVariables struct {
+	// "locals", "enclosing" or "globals"
+	Name      string
+	Variables map[string]Object
+}
+
+// the scope chain of a frame up to the globals, innermost first.
+// Builtins are left out
+func (self *Paused) Scopes(frame DebugFrame) []ScopeVariables {
+	scopes := []ScopeVariables{}
+	for scope := frame.Scope; scope != nil && scope.prev != nil; scope = scope.prev {
+		name := "enclosing"
+		switch {
+		case scope == self.interpreter.globals:
+			name = "globals"
+		case len(scopes) == 0:
+			name = "locals"
+		}
+		variables := make(map[string]Object, len(scope.current))
+		for key, value := range scope.current {
+			variables[key] = value
+		}
+		scopes = append(scopes, ScopeVariables{name, variables})
+	}
+	return scopes
+}
+
+// lines a breakpoint can pause on, those where a statement starts
+func BreakableLines(program []STATEMENT_NODE) map[int]bool {
+	lines := make(map[int]bool)
+	EachStatement(program, func(statement STATEMENT_NODE) {
+		lines[statement.GetPosition().Line] = true
+	})
+	return lines
+}
+
+// calls visit with every statement of program in source order, also
+// those in blocks and function bodies
+func EachStatement(program []STATEMENT_NODE, visit func(statement STATEMENT_NODE)) {
+	var statements func(list []STATEMENT_NODE)
+	var expression func(ex EXPRESSION_NODE)
+	statements = func(list []STATEMENT_NODE) {
+		for _, statement := range list {
+			visit(statement)
+			switch st := statement.(type) {
+			case *RETURN_STATEMENT:
+				expression(st.Expression)
+			case *LET_STATEMENT:
+				if st.Expression != nil {
+					expression(st.Expression)
+				}
+			case *FOR_STATEMENT:
+				expression(st.Condition)
+				statements(st.Body)
+			case *IF_STATEMENT:
+				expression(st.Condition)
+				statements(st.Then)
+				statements(st.Els)
+			case *SAY_STATEMENT:
+				expression(st.Expression)
+			case *EXPRESSION_STATEMENT:
+				expression(st.Expression)
+			}
+		}
+	}
+	expression = func(ex EXPRESSION_NODE) {
+		switch ex := ex.(type) {
+		case *FUNCTIONAL_EXPRESSION:
+			statements(ex.Body)
+		case *BINARY_ASSIGN_EXPRESSION:
+			expression(ex.Right)
+		case *BINARY_EXPRESSION:
+			expression(ex.Left)
+			expression(ex.Right)
+		case *UNARY_OPERATION_EXPRESSION:
+			expression(ex.Expression)
+		case *FUNCTION_CALL_EXPRESSION:
+			expression(ex.Callable)
+			for _, arg := range ex.Args {
+				expression(arg)
+			}
+		case *INDEX_OPERATOR_EXPRESSION:
+			expression(ex.Array)
+			expression(ex.Index)
+		case *ARRAY_EXPRESSION:
+			for _, element := range ex.Expressions {
+				expression(element)
+			}
+		}
+	}
+	statements(program)
+}
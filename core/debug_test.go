@@ -0,0 +1,107 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const debuggedSource = `fn add: a, b {
+    let sum = a + b
+    return sum
+}
+let x = add(1, 2)
+let i = 0
+for i < 3 {
+    i += 1
+}
+say x`
+
+func runDebugger(t *testing.T, debugger *Debugger) error {
+	t.Helper()
+	program, err := NewParser(debuggedSource).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(ioutil.Discard)
+	interpreter.SetDebugger(debugger)
+	return interpreter.Interpret(context.Background(), program)
+}
+
+// a debugger recording "reason line" of each pause, it answers the
+// pauses in turn with the actions and then continues
+func stepping(actions ...func(*Paused)) (*Debugger, *[]string) {
+	pauses := &[]string{}
+	debugger := NewDebugger(func(paused *Paused) {
+		*pauses = append(*pauses, fmt.Sprintf("%s %d", paused.Reason, paused.Statement.GetPosition().Line))
+		if len(*pauses) <= len(actions) {
+			actions[len(*pauses)-1](paused)
+		}
+	})
+	return debugger, pauses
+}
+
+func TestDebuggerSteps(t *testing.T) {
+	in, over, out := (*Paused).StepIn, (*Paused).StepOver, (*Paused).StepOut
+	tests := []struct {
+		name    string
+		actions []func(*Paused)
+		pauses  string
+	}{
+		{"step in", []func(*Paused){in, in, in, in, in}, "entry 1, step 5, step 2, step 3, step 6, step 7"},
+		{"step over", []func(*Paused){over, over, over, over, over}, "entry 1, step 5, step 6, step 7, step 8, step 7"},
+		{"step out", []func(*Paused){in, in, out}, "entry 1, step 5, step 2, step 6"},
+		{"continue", []func(*Paused){(*Paused).Continue}, "entry 1"},
+	}
+	for _, test := range tests {
+		debugger, pauses := stepping(test.actions...)
+		if err := runDebugger(t, debugger); err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		}
+		if strings.Join(*pauses, ", ") != test.pauses {
+			t.Errorf("%s paused at %v, want %s", test.name, *pauses, test.pauses)
+		}
+	}
+}
+
+func TestDebuggerBreakpoints(t *testing.T) {
+	pauses, values := []string{}, []string{}
+	debugger := NewDebugger(func(paused *Paused) {
+		pauses = append(pauses, fmt.Sprintf("%s %d", paused.Reason, paused.Statement.GetPosition().Line))
+		value, err := paused.Eval(0, "i")
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, value.ToString())
+	})
+	debugger.StopOnEntry(false)
+	breakpoint, err := debugger.SetBreakpoint(8, "i == 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runDebugger(t, debugger); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(pauses, ", ") != "breakpoint 8" || strings.Join(values, ", ") != "1" {
+		t.Errorf("paused at %v with i %v, want once at line 8 with i 1", pauses, values)
+	}
+	if breakpoint.Hits != 1 {
+		t.Errorf("the breakpoint has %d hits, want 1", breakpoint.Hits)
+	}
+
+	if _, err := debugger.SetBreakpoint(8, "let y = 1"); err == nil {
+		t.Error("a statement as the condition was accepted")
+	}
+}
+
+func TestDebuggerTerminate(t *testing.T) {
+	debugger, pauses := stepping((*Paused).StepIn, (*Paused).Terminate)
+	err := runDebugger(t, debugger)
+	if !errors.Is(err, ErrCancelled) || len(*pauses) != 2 {
+		t.Errorf("failed with %v after %v, want it cancelled after 2 pauses", err, *pauses)
+	}
+}
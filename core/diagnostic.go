@@ -0,0 +1,305 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	LEX_ERROR ErrorKind = iota
+	PARSE_ERROR
+	RUNTIME_ERROR
+)
+
+func (self ErrorKind) Format() string {
+	switch self {
+	case LEX_ERROR:
+		return "lex error"
+	case PARSE_ERROR:
+		return "parse error"
+	case RUNTIME_ERROR:
+		return "runtime error"
+	default:
+		return "error"
+	}
+}
+
+// error codes, the first digit follows the kind
+const (
+	ILLEGAL_CHARACTER_CODE    = "E001"
+	MALFORMED_NUMBER_CODE     = "E002"
+	UNTERMINATED_COMMENT_CODE = "E003"
+
+	UNEXPECTED_TOKEN_CODE = "E100"
+	UNEXPECTED_EOF_CODE   = "E101"
+	INVALID_LITERAL_CODE  = "E102"
+
+	RUNTIME_ERROR_CODE      = "E200"
+	UNDEFINED_VARIABLE_CODE = "E201"
+	REDEFINITION_CODE       = "E202"
+	TYPE_ERROR_CODE         = "E203"
+	DIVISION_BY_ZERO_CODE   = "E204"
+	NOT_CALLABLE_CODE       = "E205"
+	ARGUMENT_COUNT_CODE     = "E206"
+	UNEXPECTED_CONTROL_CODE = "E207"
+	ARGUMENT_VALUE_CODE     = "E208"
+	PERMISSION_DENIED_CODE  = "E210"
+
+	CANCELLED_CODE    = "E220"
+	TIMEOUT_CODE      = "E221"
+	STEP_LIMIT_CODE   = "E222"
+	CALL_DEPTH_CODE   = "E223"
+	MEMORY_LIMIT_CODE = "E224"
+
+	ASSERTION_CODE = "E230"
+)
+
+// ScriptError is an error with a location in the script. Start and End
+// (exclusive) are zero when the location is not known yet, the innermost
+// context passed to Chain fills them in. Notes hold the "while evaluating..."
+// contexts from the innermost to the outermost one
+type ScriptError struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+	File    string
+	Start   Position
+	End     Position
+	Notes   []string
+	// a hint on fixing the error, e.g. a "did you mean" suggestion
+	Help string
+	// calls active when the error happened, the most recent one first
+	Stack []Frame
+	Cause error
+
+	// set on the errors ToScriptError returns while they propagate,
+	// nothing else holds them yet so they are added to in place
+	propagating bool
+}
+
+// an error without a location yet
+func NewScriptError(kind ErrorKind, code string, format string, args ...interface{}) *ScriptError {
+	return &ScriptError{
+		Kind:    kind,
+		Code:    code,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func RuntimeError(code string, format string, args ...interface{}) *ScriptError {
+	return NewScriptError(RUNTIME_ERROR, code, format, args...)
+}
+
+// a context for Chain, e.g. "while evaluating SAY statement"
+func ErrorContext(kind ErrorKind, message string, start, end Position) *ScriptError {
+	return &ScriptError{
+		Kind:    kind,
+		Message: message,
+		Start:   start,
+		End:     end,
+	}
+}
+
+func (self *ScriptError) Error() string {
+	var builder strings.Builder
+	builder.WriteString(self.Location())
+	fmt.Fprintf(&builder, ": %s[%s]: %s", self.Kind.Format(), self.Code, self.Message)
+	for _, note := range self.collapsedNotes() {
+		builder.WriteString("\n    note: ")
+		builder.WriteString(note)
+	}
+	if self.Help != "" {
+		builder.WriteString("\n    help: ")
+		builder.WriteString(self.Help)
+	}
+	if len(self.Stack) > 0 {
+		builder.WriteString("\n")
+		builder.WriteString(FormatStack(self.Stack))
+	}
+	return builder.String()
+}
+
+func (self *ScriptError) Unwrap() error {
+	return self.Cause
+}
+
+// "file:line:column", parts that are not known are left out
+func (self *ScriptError) Location() string {
+	parts := []string{}
+	if self.File != "" {
+		parts = append(parts, self.File)
+	}
+	if self.Start.Line > 0 {
+		parts = append(parts, fmt.Sprint(self.Start.Line), fmt.Sprint(self.Start.Column))
+	}
+	if len(parts) == 0 {
+		return "<script>"
+	}
+	return strings.Join(parts, ":")
+}
+
+func (self *ScriptError) HasPosition() bool {
+	return self.Start.Line > 0
+}
+
+// renders the error in compiler style, source is the text the error
+// positions refer to:
+//
+//	runtime error[E201]: trying to get uninitialized variable "x"
+//	 --> main.it:3:5
+//	  |
+//	3 | say x + 1
+//	  |     ^
+//	  = note: while evaluating SAY statement at line 3, column 1
+func (self *ScriptError) Render(source string) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "%s[%s]: %s\n", self.Kind.Format(), self.Code, self.Message)
+
+	lines := strings.Split(source, "\n")
+	gutter := len(fmt.Sprint(self.Start.Line))
+	pad := strings.Repeat(" ", gutter)
+	fmt.Fprintf(&builder, "%s--> %s\n", pad, self.Location())
+
+	if self.HasPosition() && self.Start.Line <= len(lines) {
+		line := strings.TrimRight(lines[self.Start.Line-1], "\r")
+		fmt.Fprintf(&builder, "%s |\n", pad)
+		fmt.Fprintf(&builder, "%d | %s\n", self.Start.Line, line)
+		fmt.Fprintf(&builder, "%s | %s\n", pad, self.underline(line))
+	}
+	for _, note := range self.collapsedNotes() {
+		fmt.Fprintf(&builder, "%s = note: %s\n", pad, note)
+	}
+	if self.Help != "" {
+		fmt.Fprintf(&builder, "%s = help: %s\n", pad, self.Help)
+	}
+	if len(self.Stack) > 0 {
+		builder.WriteString(FormatStack(self.Stack))
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// notes with runs of the same note, e.g. from recursion, written once
+func (self *ScriptError) collapsedNotes() []string {
+	notes := []string{}
+	for i := 0; i < len(self.Notes); {
+		j := i + 1
+		for j < len(self.Notes) && self.Notes[j] == self.Notes[i] {
+			j++
+		}
+		if j-i > 1 {
+			notes = append(notes, fmt.Sprintf("%s (%d times)", self.Notes[i], j-i))
+		} else {
+			notes = append(notes, self.Notes[i])
+		}
+		i = j
+	}
+	return notes
+}
+
+// carets under the error span, tabs are kept so the carets line up
+func (self *ScriptError) underline(line string) string {
+	runes := []rune(line)
+	var builder strings.Builder
+	for i := 0; i < self.Start.Column-1 && i < len(runes); i++ {
+		if runes[i] == '\t' {
+			builder.WriteRune('\t')
+		} else {
+			builder.WriteRune(' ')
+		}
+	}
+	width := 1
+	if self.End.Line == self.Start.Line && self.End.Column > self.Start.Column {
+		width = self.End.Column - self.Start.Column
+	} else if self.End.Line > self.Start.Line && len(runes) >= self.Start.Column {
+		// the span continues on the next lines, underline to the end of this one
+		width = len(runes) - self.Start.Column + 1
+	}
+	builder.WriteString(strings.Repeat("^", width))
+	return builder.String()
+}
+
+// ErrorList is every error of a parse, in source order
+type ErrorList []*ScriptError
+
+func (self ErrorList) Error() string {
+	messages := make([]string, len(self))
+	for i, err := range self {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// the first error, so errors.As finds a ScriptError in the list
+func (self ErrorList) Unwrap() error {
+	if len(self) == 0 {
+		return nil
+	}
+	return self[0]
+}
+
+// error codes of the errors the interpreter reports without a ScriptError
+func CodeOf(err error) string {
+	switch {
+	case errors.Is(err, DIVISION_BY_ZERO_ERROR):
+		return DIVISION_BY_ZERO_CODE
+	case errors.Is(err, ErrPermissionDenied):
+		return PERMISSION_DENIED_CODE
+	case errors.Is(err, ErrCancelled):
+		return CANCELLED_CODE
+	case errors.Is(err, ErrTimeout):
+		return TIMEOUT_CODE
+	case errors.Is(err, ErrStepLimitExceeded):
+		return STEP_LIMIT_CODE
+	case errors.Is(err, ErrCallDepthExceeded):
+		return CALL_DEPTH_CODE
+	case errors.Is(err, ErrMemoryLimitExceeded):
+		return MEMORY_LIMIT_CODE
+	case errors.Is(err, ErrAssertion):
+		return ASSERTION_CODE
+	default:
+		return RUNTIME_ERROR_CODE
+	}
+}
+
+// err as a ScriptError to add to, a ScriptError of kind wrapping it if it
+// is not one. A ScriptError that is not propagating may be shared, e.g.
+// with the ErrorList of the parser, so it is copied first
+func ToScriptError(kind ErrorKind, err error) *ScriptError {
+	if scriptErr, ok := err.(*ScriptError); ok {
+		if scriptErr.propagating {
+			return scriptErr
+		}
+		copied := *scriptErr
+		copied.Notes = append([]string(nil), scriptErr.Notes...)
+		copied.propagating = true
+		return &copied
+	}
+	return &ScriptError{
+		Kind:        kind,
+		Code:        CodeOf(err),
+		Message:     err.Error(),
+		Cause:       err,
+		propagating: true,
+	}
+}
+
+// ends the propagation of the ScriptError err is or wraps, once it is
+// stored or handed to the host later additions go to a copy
+func settle(err error) {
+	if scriptErr, ok := AsScriptError(err); ok {
+		scriptErr.propagating = false
+	}
+}
+
+// the ScriptError err is or wraps, if any
+func AsScriptError(err error) (*ScriptError, bool) {
+	var scriptErr *ScriptError
+	if errors.As(err, &scriptErr) {
+		return scriptErr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,118 @@
+package core
+
+import "context"
+
+// Embedding API for host applications:
+//
+//	interpreter := core.NewInterpreter()
+//	interpreter.SetGlobal("limit", 10)
+//	interpreter.RegisterFunc("lookup", func(key string) (string, error) { ... })
+//	result, err := interpreter.Eval(`lookup("a") + "!"`)
+//
+// Values are converted with ToObject and FromObject, see convert.go
+
+// Eval runs code in the global scope of the interpreter, so state is kept
+// between calls. The result is the value of the last statement if it is an
+// expression, NULL otherwise
+func (self *Interpreter) Eval(code string) (Object, error) {
+	return self.EvalContext(context.Background(), code)
+}
+
+func (self *Interpreter) EvalContext(ctx context.Context, code string) (Object, error) {
+	program, err := NewParser(code).ParseProgram()
+	if err != nil {
+		return nil, err
+	}
+	return self.EvalProgram(ctx, program)
+}
+
+// EvalProgram is Eval for an already parsed program
+func (self *Interpreter) EvalProgram(ctx context.Context, program []STATEMENT_NODE) (Object, error) {
+	var result Object = NULL{}
+	err := self.run(ctx, func() error {
+		if len(program) == 0 {
+			return nil
+		}
+		last, ok := program[len(program)-1].(*EXPRESSION_STATEMENT)
+		if !ok {
+			return self.Interpret(ctx, program)
+		}
+		if err := self.Interpret(ctx, program[:len(program)-1]); err != nil {
+			return err
+		}
+		if err := self.Step(); err != nil {
+			return err
+		}
+		obj, err := self.EvalExpression(last.Expression)
+		if err != nil {
+			position := last.GetPosition()
+			return Chain(ErrorContext(RUNTIME_ERROR, "while evaluating EXPRESSION statement",
+				position, position), err)
+		}
+		result = obj
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetGlobal converts value with ToObject and binds it in the global scope,
+// replacing the previous binding if there is one
+func (self *Interpreter) SetGlobal(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return err
+	}
+	self.globals.Define(name, obj)
+	return nil
+}
+
+func (self *Interpreter) GetGlobal(name string) (Object, error) {
+	return self.globals.Get(name)
+}
+
+// RegisterFunc makes a Go function callable from scripts under name,
+// see WrapFunc for the supported signatures
+func (self *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	builtin, err := WrapFunc(name, fn)
+	if err != nil {
+		return err
+	}
+	self.globals.Define(name, builtin)
+	return nil
+}
+
+// Call invokes a script FUNCTION or BUILTIN, e.g. one passed to the host
+// as a callback, arguments are converted with ToObject
+func (self *Interpreter) Call(fn Object, args ...interface{}) (Object, error) {
+	return self.CallContext(context.Background(), fn, args...)
+}
+
+func (self *Interpreter) CallContext(ctx context.Context, fn Object, args ...interface{}) (Object, error) {
+	callable, ok := fn.(CALLABLE)
+	if !ok {
+		return nil, RuntimeError(NOT_CALLABLE_CODE, "cannot call non-callable object of type %s",
+			Typeof(fn))
+	}
+	objects := make([]Object, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, err
+		}
+		objects[i] = obj
+	}
+
+	var result Object
+	err := self.run(ctx, func() error {
+		obj, err := callable.Call(self, objects)
+		result = obj
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,362 @@
+package core
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Canonical source formatting: one statement per line, no semicolons,
+// INDENT per block level, single spaces around binary operators and only
+// the parentheses precedence needs. Comments are put back before the
+// statement they precede or at the end of the line they trailed, a
+// comment inside a multi-line expression moves after that statement.
+// Literals keep the way they were written and single blank lines between
+// statements are kept
+
+const INDENT = "    "
+
+// Format parses source and returns it formatted, syntax errors are
+// returned as the ErrorList of ParseProgram
+func Format(source string) (string, error) {
+	parser := NewParser(source)
+	program, err := parser.ParseProgram()
+	if err != nil {
+		return "", err
+	}
+	shebang := ""
+	if strings.HasPrefix(source, "#!") {
+		shebang = strings.TrimRight(strings.SplitN(source, "\n", 2)[0], "\r")
+	}
+	return FormatProgram(program, parser.Comments(), shebang), nil
+}
+
+// FormatProgram formats a parsed program, comments are the trivia of
+// Parser.Comments and shebang an optional first line
+func FormatProgram(program []STATEMENT_NODE, comments []Comment, shebang string) string {
+	formatter := &formatter{comments: comments}
+	if shebang != "" {
+		formatter.write(shebang)
+		formatter.newline()
+		formatter.lastLine = 1
+	}
+	formatter.statements(program, Position{})
+	if len(formatter.lines) == 0 {
+		return ""
+	}
+	return strings.Join(formatter.lines, "\n") + "\n"
+}
+
+type formatter struct {
+	lines    []string
+	current  string
+	indent   int
+	comments []Comment
+	// index of the first comment not written yet
+	next int
+	// last source line written, for keeping blank lines
+	lastLine int
+	// nothing was written in the current block yet
+	blockStart bool
+}
+
+func (self *formatter) write(text string) {
+	if self.current == "" {
+		self.current = strings.Repeat(INDENT, self.indent)
+	}
+	self.current += text
+}
+
+func (self *formatter) newline() {
+	self.lines = append(self.lines, strings.TrimRight(self.current, " "))
+	self.current = ""
+}
+
+// a blank line if the source had one before line
+func (self *formatter) blankLine(line int) {
+	if !self.blockStart && self.lastLine > 0 && line-self.lastLine > 1 {
+		self.lines = append(self.lines, "")
+	}
+}
+
+// writes the comments starting before end, a zero end writes all of them
+func (self *formatter) commentsBefore(end Position) {
+	for self.next < len(self.comments) {
+		comment := self.comments[self.next]
+		if end.Line > 0 && !Before(comment.Start, end) {
+			return
+		}
+		self.next++
+		if comment.Trailing && len(self.lines) > 0 && !self.blockStart &&
+			self.lastLine == comment.Start.Line && self.lines[len(self.lines)-1] != "" {
+			self.lines[len(self.lines)-1] += " " + comment.Text
+		} else {
+			self.blankLine(comment.Start.Line)
+			for i, line := range strings.Split(comment.Text, "\n") {
+				if i == 0 {
+					self.write(line)
+				} else {
+					// the rest of a block comment stays as it was
+					self.current = strings.TrimRight(line, "\r")
+				}
+				self.newline()
+			}
+		}
+		self.blockStart = false
+		self.lastLine = comment.End.Line
+	}
+}
+
+func Before(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// writes a statement list up to end, the position of its closing "}"
+func (self *formatter) statements(list []STATEMENT_NODE, end Position) {
+	for _, statement := range list {
+		self.commentsBefore(statement.GetPosition())
+		self.blankLine(statement.GetPosition().Line)
+		self.statement(statement)
+		self.newline()
+		self.blockStart = false
+		self.lastLine = statement.GetEnd().Line
+	}
+	self.commentsBefore(end)
+}
+
+// writes "{", the statements up to end and "}" on a line of its own
+func (self *formatter) block(list []STATEMENT_NODE, end Position) {
+	if len(list) == 0 && !self.hasCommentBefore(end) {
+		self.write("{}")
+		return
+	}
+	self.write("{")
+	self.newline()
+	self.indent++
+	self.blockStart = true
+	self.statements(list, end)
+	self.indent--
+	self.blockStart = false
+	self.write("}")
+}
+
+func (self *formatter) hasCommentBefore(end Position) bool {
+	return self.next < len(self.comments) && Before(self.comments[self.next].Start, end)
+}
+
+func (self *formatter) statement(statement STATEMENT_NODE) {
+	switch st := statement.(type) {
+	case *BREAK_STATEMENT:
+		self.write("break")
+	case *CONTINUE_STATEMENT:
+		self.write("continue")
+	case *RETURN_STATEMENT:
+		self.write("return ")
+		self.expression(st.Expression, LOWEST_PRECEDENCE)
+	case *LET_STATEMENT:
+		self.write("let " + st.Identifier)
+		if st.Expression != nil {
+			self.write(" = ")
+			self.expression(st.Expression, LOWEST_PRECEDENCE)
+		}
+	case *FOR_STATEMENT:
+		self.write("for ")
+		self.expression(st.Condition, LOWEST_PRECEDENCE)
+		self.write(" ")
+		self.block(st.Body, st.End)
+	case *IF_STATEMENT:
+		self.write("if ")
+		self.expression(st.Condition, LOWEST_PRECEDENCE)
+		self.write(" ")
+		self.block(st.Then, st.ThenEnd)
+		if st.Els != nil {
+			self.write(" else ")
+			self.block(st.Els, st.End)
+		}
+	case *SAY_STATEMENT:
+		self.write("say ")
+		self.expression(st.Expression, LOWEST_PRECEDENCE)
+	case *EXPRESSION_STATEMENT:
+		self.expression(st.Expression, LOWEST_PRECEDENCE)
+	}
+}
+
+// binding strength of expressions, a higher one binds tighter
+const (
+	LOWEST_PRECEDENCE = iota
+	ASSIGN_PRECEDENCE
+	OR_PRECEDENCE
+	AND_PRECEDENCE
+	EQUALITY_PRECEDENCE
+	COMPARISON_PRECEDENCE
+	SUM_PRECEDENCE
+	PRODUCT_PRECEDENCE
+	UNARY_PRECEDENCE
+	POSTFIX_PRECEDENCE
+	PRIMARY_PRECEDENCE
+)
+
+func OperatorPrecedence(operator string) int {
+	switch operator {
+	case "|":
+		return OR_PRECEDENCE
+	case "&":
+		return AND_PRECEDENCE
+	case "==", "!=":
+		return EQUALITY_PRECEDENCE
+	case ">", "<", ">=", "<=":
+		return COMPARISON_PRECEDENCE
+	case "+", "-":
+		return SUM_PRECEDENCE
+	default:
+		return PRODUCT_PRECEDENCE
+	}
+}
+
+func Precedence(expression EXPRESSION_NODE) int {
+	switch ex := expression.(type) {
+	case *BINARY_ASSIGN_EXPRESSION:
+		return ASSIGN_PRECEDENCE
+	case *BINARY_EXPRESSION:
+		return OperatorPrecedence(ex.Operator)
+	case *UNARY_OPERATION_EXPRESSION:
+		return UNARY_PRECEDENCE
+	case *FUNCTION_CALL_EXPRESSION, *INDEX_OPERATOR_EXPRESSION:
+		return POSTFIX_PRECEDENCE
+	case *FUNCTIONAL_EXPRESSION:
+		// a lambda body takes everything after the ":"
+		if ex.Lambda {
+			return LOWEST_PRECEDENCE
+		}
+		return PRIMARY_PRECEDENCE
+	default:
+		return PRIMARY_PRECEDENCE
+	}
+}
+
+// writes expression, in parentheses if it binds weaker than min
+func (self *formatter) expression(expression EXPRESSION_NODE, min int) {
+	if Precedence(expression) < min {
+		self.write("(")
+		self.expression(expression, LOWEST_PRECEDENCE)
+		self.write(")")
+		return
+	}
+
+	switch ex := expression.(type) {
+	case *BINARY_ASSIGN_EXPRESSION:
+		self.write(ex.Left + " " + ex.Operator + " ")
+		self.expression(ex.Right, ASSIGN_PRECEDENCE)
+	case *BINARY_EXPRESSION:
+		// operators are left associative, a right operand of the same
+		// precedence needs parentheses
+		precedence := OperatorPrecedence(ex.Operator)
+		self.expression(ex.Left, precedence)
+		self.write(" " + ex.Operator + " ")
+		self.expression(ex.Right, precedence+1)
+	case *UNARY_OPERATION_EXPRESSION:
+		self.write(ex.Operator)
+		// -(-x) and !(!x) and not --x, which reads like a decrement
+		if inner, ok := ex.Expression.(*UNARY_OPERATION_EXPRESSION); ok && inner.Operator == ex.Operator {
+			self.write("(")
+			self.expression(inner, LOWEST_PRECEDENCE)
+			self.write(")")
+			return
+		}
+		self.expression(ex.Expression, UNARY_PRECEDENCE)
+	case *FUNCTION_CALL_EXPRESSION:
+		self.expression(ex.Callable, POSTFIX_PRECEDENCE)
+		self.write("(")
+		self.expressionList(ex.Args)
+		self.write(")")
+	case *INDEX_OPERATOR_EXPRESSION:
+		self.expression(ex.Array, POSTFIX_PRECEDENCE)
+		self.write("[")
+		self.expression(ex.Index, LOWEST_PRECEDENCE)
+		self.write("]")
+	case *ARRAY_EXPRESSION:
+		self.write("[")
+		self.expressionList(ex.Expressions)
+		self.write("]")
+	case *VARIABLE_EXPRESSION:
+		self.write(ex.Identifier)
+	case *NULL_EXPRESSION:
+		self.write("null")
+	case *PRIMITIVE_LITERAL_EXPRESSION:
+		self.write(FormatLiteral(ex))
+	case *FUNCTIONAL_EXPRESSION:
+		self.function(ex)
+	}
+}
+
+func (self *formatter) expressionList(list []EXPRESSION_NODE) {
+	for i, expression := range list {
+		if i > 0 {
+			self.write(", ")
+		}
+		self.expression(expression, LOWEST_PRECEDENCE)
+	}
+}
+
+func (self *formatter) function(ex *FUNCTIONAL_EXPRESSION) {
+	args := strings.Join(ex.Args, ", ")
+	if ex.Lambda {
+		self.write("lambda")
+		if args != "" {
+			self.write(" " + args)
+		}
+		self.write(": ")
+		if body, ok := ex.Body[0].(*RETURN_STATEMENT); ok && len(ex.Body) == 1 {
+			self.expression(body.Expression, LOWEST_PRECEDENCE)
+		}
+		return
+	}
+	self.write("fn")
+	if ex.Identifier != "" {
+		self.write(" " + ex.Identifier)
+	}
+	self.write(":")
+	if args != "" {
+		self.write(" " + args)
+	}
+	self.write(" ")
+	// the statements of the body keep their own blank lines
+	lastLine := self.lastLine
+	self.lastLine = ex.Span.Start.Line
+	self.block(ex.Body, ex.Span.End)
+	self.lastLine = lastLine
+}
+
+// the literal as written, or rebuilt from its value if the parser did
+// not record it
+func FormatLiteral(ex *PRIMITIVE_LITERAL_EXPRESSION) string {
+	if str, ok := ex.Value.(string); ok {
+		if strings.ContainsRune(str, '"') {
+			return "'" + str + "'"
+		}
+		return "\"" + str + "\""
+	}
+	if ex.Raw != "" {
+		return ex.Raw
+	}
+	switch t := ex.Value.(type) {
+	case int:
+		return strconv.Itoa(t)
+	case *big.Int:
+		return t.String()
+	case float64:
+		literal := strconv.FormatFloat(t, 'g', -1, 64)
+		if !strings.ContainsAny(literal, ".eE") {
+			literal += ".0"
+		}
+		return literal
+	case DECIMAL:
+		return t.ToString() + "d"
+	case *big.Rat:
+		return t.RatString() + "r"
+	case bool:
+		return strconv.FormatBool(t)
+	default:
+		return "null"
+	}
+}
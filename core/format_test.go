@@ -0,0 +1,81 @@
+package core
+
+import (
+	"testing"
+)
+
+var formatTests = []struct {
+	source    string
+	formatted string
+}{
+	{"let   x=1;let y = (x+2)*3", "let x = 1\nlet y = (x + 2) * 3\n"},
+	{"say (1 - 2) - 3\nsay 1 - (2 - 3)", "say 1 - 2 - 3\nsay 1 - (2 - 3)\n"},
+	{"say [1,2,[3]][0]", "say [1, 2, [3]][0]\n"},
+	{"if x>1{say 1}else{say 2}", "if x > 1 {\n    say 1\n} else {\n    say 2\n}\n"},
+	{"fn add:a,b{return a+b}", "fn add: a, b {\n    return a + b\n}\n"},
+	{"let f = lambda x:x*2", "let f = lambda x: x * 2\n"},
+	{"#!/usr/bin/env interpreter\nsay 1", "#!/usr/bin/env interpreter\nsay 1\n"},
+	// a unary operand of the same operator keeps its parentheses
+	{"say -(-x)", "say -(-x)\n"},
+	{"say - -x", "say -(-x)\n"},
+	{"say !(!x)", "say !(!x)\n"},
+	{"say -(-(-x))", "say -(-(-x))\n"},
+	{"say -(!x)", "say -!x\n"},
+	{"say -(1)", "say -1\n"},
+	// comments
+	{"# head\nlet x = 1 # trailing\n\n\n/* block\n   comment */\nsay x",
+		"# head\nlet x = 1 # trailing\n\n/* block\n   comment */\nsay x\n"},
+	{"for i < 3 {\n# inside\ni += 1\n}", "for i < 3 {\n    # inside\n    i += 1\n}\n"},
+	{"fn f: {\n    # only a comment\n}", "fn f: {\n    # only a comment\n}\n"},
+	{"let x = 1 + # inside\n 2", "let x = 1 + 2\n# inside\n"},
+	{"## doc\nfn f: {}\nsay 1 /* after */", "## doc\nfn f: {}\nsay 1 /* after */\n"},
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range formatTests {
+		formatted, err := Format(test.source)
+		if err != nil {
+			t.Errorf("Format(%q) failed: %s", test.source, err)
+			continue
+		}
+		if formatted != test.formatted {
+			t.Errorf("Format(%q) = %q, want %q", test.source, formatted, test.formatted)
+		}
+	}
+}
+
+func TestFormatIdempotent(t *testing.T) {
+	for _, test := range formatTests {
+		again, err := Format(test.formatted)
+		if err != nil {
+			t.Errorf("Format(%q) failed: %s", test.formatted, err)
+			continue
+		}
+		if again != test.formatted {
+			t.Errorf("Format(%q) = %q, formatting twice changed it", test.formatted, again)
+		}
+	}
+}
+
+// every comment survives formatting with its text, in the same order
+func TestFormatKeepsComments(t *testing.T) {
+	for _, test := range formatTests {
+		before := NewParser(test.source)
+		before.ParseProgram()
+		after := NewParser(test.formatted)
+		if _, err := after.ParseProgram(); err != nil {
+			t.Errorf("%q does not parse: %s", test.formatted, err)
+			continue
+		}
+		comments, formatted := before.Comments(), after.Comments()
+		if len(comments) != len(formatted) {
+			t.Errorf("%q has %d comments, %q has %d", test.source, len(comments), test.formatted, len(formatted))
+			continue
+		}
+		for i := range comments {
+			if comments[i].Text != formatted[i].Text {
+				t.Errorf("comment %q became %q", comments[i].Text, formatted[i].Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// runs source and returns what it printed, parse errors fail the test
+func runScript(t *testing.T, source string) (string, error) {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatalf("parsing %q: %s", source, err)
+	}
+	var output strings.Builder
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(&output)
+	err = interpreter.Interpret(context.Background(), program)
+	return output.String(), err
+}
@@ -1,8 +1,15 @@
 package core
 
 import (
+	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
 )
 
 var UNKNOWN_ERROR error = errors.New("UNKNOWN ERROR: something went wrong :(")
@@ -38,15 +45,83 @@ func (s RETURN_CALLBACK) FormatCallback() string {
 
 // main Interpreter
 type Interpreter struct {
-	scope *Scope
+	scope   *Scope
+	globals *Scope
+	policy  Policy
+	// variables set by setenv, over the process environment, see Getenv
+	env map[string]string
+
+	stdin          *bufio.Reader
+	stdout, stderr io.Writer
+
+	// execution limits, see limits.go
+	ctx, parentCtx              context.Context
+	timeout                     time.Duration
+	steps, maxSteps             int
+	callDepth, maxCallDepth     int
+	allocated, allocationBudget int
+
+	// active calls, see stack.go
+	frames []Frame
+	// the scope each of frames was called from
+	callers []*Scope
+	// statement lists being evaluated, see ExplainUndefined
+	blocks []*activeBlock
+	// LET may rebind a global instead of failing, see AllowRedefinition
+	redefine bool
+	// see debug.go, profile.go and coverage.go
+	debugger *Debugger
+	profiler *Profiler
+	coverage *Coverage
 }
 
 func NewInterpreter() *Interpreter {
+	policy := DefaultPolicy()
+	scope := MakeScope(policy)
 	return &Interpreter{
-		scope: MakeScope(),
+		scope:   scope,
+		globals: scope,
+		policy:  policy,
+		stdin:   bufio.NewReader(os.Stdin),
+		stdout:  os.Stdout,
+		stderr:  os.Stderr,
+
+		maxCallDepth: DEFAULT_MAX_CALL_DEPTH,
 	}
 }
 
+// streams used by SAY, print, input and readline,
+// the process standard streams by default
+func (self *Interpreter) SetStdin(reader io.Reader) {
+	self.stdin = bufio.NewReader(reader)
+}
+
+func (self *Interpreter) SetStdout(writer io.Writer) {
+	self.stdout = writer
+}
+
+func (self *Interpreter) SetStderr(writer io.Writer) {
+	self.stderr = writer
+}
+
+func (self *Interpreter) Stdin() *bufio.Reader {
+	return self.stdin
+}
+
+func (self *Interpreter) Stdout() io.Writer {
+	return self.stdout
+}
+
+func (self *Interpreter) Stderr() io.Writer {
+	return self.stderr
+}
+
+// lets LET statements at the top level redefine globals, e.g. in a REPL
+// where the same definition is entered again after a fix
+func (self *Interpreter) AllowRedefinition(allow bool) {
+	self.redefine = allow
+}
+
 func (self *Interpreter) EnterNewScope() {
 	self.scope = self.scope.NewChild()
 }
@@ -55,22 +130,47 @@ func (self *Interpreter) LeaveScope() {
 	self.scope = self.scope.prev
 }
 
-func (self *Interpreter) Interpret(program []STATEMENT_NODE) error {
-	cb, err := self.EvalStatementList(program)
-	if err != nil {
-		return err
-	}
-	if cb != nil {
-		return errors.New(fmt.Sprintf("unexpected callback %s in program", cb.FormatCallback()))
-	}
-	return nil
+// runs program until it finishes, fails, or ctx is done,
+// see limits.go for the other ways to bound the execution
+func (self *Interpreter) Interpret(ctx context.Context, program []STATEMENT_NODE) error {
+	return self.run(ctx, func() error {
+		cb, err := self.EvalStatementList(program)
+		if err != nil {
+			return err
+		}
+		if cb != nil {
+			return RuntimeError(UNEXPECTED_CONTROL_CODE, "unexpected callback %s in program", cb.FormatCallback())
+		}
+		return nil
+	})
 }
 
 func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, error) {
-	for _, statement := range list {
+	block := &activeBlock{statements: list}
+	self.blocks = append(self.blocks, block)
+	defer func() { self.blocks = self.blocks[:len(self.blocks)-1] }()
+
+	for index, statement := range list {
+		block.index = index
 
 		StmtErr := func(info string) error {
-			return errors.New(fmt.Sprintf("%s: %s", info, statement.GetPosition().Format()))
+			position := statement.GetPosition()
+			return ErrorContext(RUNTIME_ERROR, info, position, position)
+		}
+
+		if err := self.Step(); err != nil {
+			return nil, err
+		}
+		if self.debugger != nil {
+			if err := self.debugger.before(self, statement); err != nil {
+				return nil, err
+			}
+		}
+		if self.profiler != nil {
+			self.profiler.hit(statement)
+		}
+		if self.coverage != nil {
+			self.coverage.hit(statement)
 		}
 
 		switch st := statement.(type) {
@@ -91,26 +191,46 @@ func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, err
 				if err != nil {
 					return nil, Chain(StmtErr("while evaluating LET statement"), err)
 				}
+				// anonymous functions are named after the variable
+				if fn, ok := obj.(FUNCTION); ok && fn.Name == "" {
+					fn.Name = st.Identifier
+					obj = fn
+				}
 				initial = obj
 			} else {
 				initial = NULL{}
 			}
-			if err := self.scope.Init(st.Identifier, initial); err != nil {
+			if self.redefine && self.scope == self.globals {
+				self.scope.Define(st.Identifier, initial)
+			} else if err := self.scope.Init(st.Identifier, initial); err != nil {
 				return nil, Chain(StmtErr("while evaluating LET statement"), err)
 			}
 		case *FOR_STATEMENT:
-			for {
+			for iteration := 0; ; iteration++ {
+				// the debugger also stops before the condition is checked again
+				if self.debugger != nil && iteration > 0 {
+					if err := self.debugger.before(self, statement); err != nil {
+						return nil, err
+					}
+				}
 				val, err := self.EvalExpression(st.Condition)
 				if err != nil {
 					return nil, Chain(StmtErr("while evaluating FOR condition"), err)
 				}
 				ok, err := val.ToBoolean()
 				if err != nil {
-					return nil, Chain(StmtErr("white evaluating FOR condition"), err)
+					return nil, Chain(StmtErr("while evaluating FOR condition"), err)
+				}
+				if self.coverage != nil {
+					self.coverage.branch(statement, bool(ok))
 				}
 				if !ok {
 					break
 				}
+				// an empty body must not escape the step budget
+				if err := self.Step(); err != nil {
+					return nil, err
+				}
 
 				self.EnterNewScope()
 				cb, err := self.EvalStatementList(st.Body)
@@ -135,7 +255,10 @@ func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, err
 			}
 			ok, err := val.ToBoolean()
 			if err != nil {
-				return nil, Chain(StmtErr("white evaluating IF condition"), err)
+				return nil, Chain(StmtErr("while evaluating IF condition"), err)
+			}
+			if self.coverage != nil {
+				self.coverage.branch(statement, bool(ok))
 			}
 
 			if ok {
@@ -143,7 +266,7 @@ func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, err
 				cb, err := self.EvalStatementList(st.Then)
 				self.LeaveScope()
 				if err != nil {
-					return nil, Chain(StmtErr("white evaluating IF then branch"), err)
+					return nil, Chain(StmtErr("while evaluating IF then branch"), err)
 				}
 				if cb != nil {
 					return cb, nil
@@ -153,7 +276,7 @@ func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, err
 				cb, err := self.EvalStatementList(st.Els)
 				self.LeaveScope()
 				if err != nil {
-					return nil, Chain(StmtErr("white evaluating IF else branch"), err)
+					return nil, Chain(StmtErr("while evaluating IF else branch"), err)
 				}
 				if cb != nil {
 					return cb, nil
@@ -164,27 +287,91 @@ func (self *Interpreter) EvalStatementList(list []STATEMENT_NODE) (CALLBACK, err
 			if err != nil {
 				return nil, Chain(StmtErr("while evaluating SAY statement"), err)
 			}
-			fmt.Println(obj.ToString())
+			if _, err := fmt.Fprintln(self.stdout, obj.ToString()); err != nil {
+				return nil, Chain(StmtErr("while evaluating SAY statement"), err)
+			}
 		case *EXPRESSION_STATEMENT:
 			_, err := self.EvalExpression(st.Expression)
 			if err != nil {
 				return nil, Chain(StmtErr("while evaluating EXPRESSION statement"), err)
 			}
+		case *ERROR_STATEMENT:
+			// a partial AST of a program with syntax errors
+			return nil, st.Err
 		}
 	}
 	return nil, nil
 }
 
+func (self *Interpreter) CallFunction(fn FUNCTION, args []Object) (Object, error) {
+	if len(args) != len(fn.Args) {
+		return nil, RuntimeError(ARGUMENT_COUNT_CODE, "expected %d args, found %d args",
+			len(fn.Args), len(args))
+	}
+
+	if self.maxCallDepth > 0 && self.callDepth >= self.maxCallDepth {
+		return nil, fmt.Errorf("%w: maximum depth is %d", ErrCallDepthExceeded, self.maxCallDepth)
+	}
+	self.callDepth++
+	defer func() { self.callDepth-- }()
+
+	before_call := self.scope
+	self.scope = fn.Context.NewChild()
+	for i := 0; i < len(args); i++ {
+		self.scope.Init(fn.Args[i], args[i])
+	}
+	self.blocks = append(self.blocks, &activeBlock{call: true})
+	cb, err := self.EvalStatementList(fn.Body)
+	self.blocks = self.blocks[:len(self.blocks)-1]
+	self.scope = before_call
+	if err != nil {
+		return nil, err
+	}
+	switch cbv := cb.(type) {
+	case BREAK_CALLBACK:
+		return nil, RuntimeError(UNEXPECTED_CONTROL_CODE, "unexpected BREAK callback in function call")
+	case CONTINUE_CALLBACK:
+		return nil, RuntimeError(UNEXPECTED_CONTROL_CODE, "unexpected CONTINUE callback in function call")
+	case RETURN_CALLBACK:
+		return cbv.value, nil
+	}
+	return NULL{}, nil
+}
+
+// errors get the span of the innermost expression that failed
 func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, error) {
+	obj, err := self.evalExpression(expression)
+	if err != nil {
+		scriptErr := ToScriptError(RUNTIME_ERROR, err)
+		if !scriptErr.HasPosition() {
+			span := expression.GetSpan()
+			scriptErr.Start, scriptErr.End = span.Start, span.End
+		}
+		return nil, scriptErr
+	}
+	return obj, nil
+}
+
+func (self *Interpreter) evalExpression(expression EXPRESSION_NODE) (Object, error) {
 	switch ex := expression.(type) {
 	case *NULL_EXPRESSION:
 		return NULL{}, nil
 	case *VARIABLE_EXPRESSION:
-		return self.scope.Get(ex.Identifier)
+		obj, err := self.scope.Get(ex.Identifier)
+		if err != nil {
+			return nil, self.ExplainUndefined(ex.Identifier, err)
+		}
+		return obj, nil
 	case *PRIMITIVE_LITERAL_EXPRESSION:
 		switch t := ex.Value.(type) {
 		case int:
 			return INT(t), nil
+		case *big.Int:
+			return NormalizeInteger(t), nil
+		case *big.Rat:
+			return RATIONAL{t}, nil
+		case DECIMAL:
+			return t, nil
 		case float64:
 			return FLOAT(t), nil
 		case string:
@@ -199,25 +386,40 @@ func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, err
 		if err != nil {
 			return nil, err
 		}
-		arr, ok := arrv.(ARRAY)
-		if !ok {
-			return nil, errors.New("cannot get index of non-array object")
-		}
 		indv, err := self.EvalExpression(ex.Index)
 		if err != nil {
 			return nil, err
 		}
+
+		if m, ok := arrv.(MAP); ok {
+			key, ok := indv.(STRING)
+			if !ok {
+				return nil, RuntimeError(TYPE_ERROR_CODE, "map key must be typeof STRING")
+			}
+			if val, ok := m[string(key)]; ok {
+				return val, nil
+			}
+			return NULL{}, nil
+		}
+
+		arr, ok := arrv.(ARRAY)
+		if !ok {
+			return nil, RuntimeError(TYPE_ERROR_CODE, "cannot get index of non-array object")
+		}
 		ind, ok := indv.(INT)
 		if !ok {
-			return nil, errors.New("index must be typeof INT")
+			return nil, RuntimeError(TYPE_ERROR_CODE, "index must be typeof INT")
 		}
 
-		if int(ind) >= len(arr) {
+		if int(ind) < 0 || int(ind) >= len(arr) {
 			return NULL{}, nil
 		} else {
 			return arr[int(ind)], nil
 		}
 	case *ARRAY_EXPRESSION:
+		if err := self.Allocate(ArraySize(len(ex.Expressions))); err != nil {
+			return nil, err
+		}
 		objarr := make([]Object, len(ex.Expressions))
 		for i, v := range ex.Expressions {
 			obj, err := self.EvalExpression(v)
@@ -232,43 +434,29 @@ func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, err
 		if err != nil {
 			return nil, err
 		}
-		fn, ok := fv.(FUNCTION)
+		fn, ok := fv.(CALLABLE)
 		if !ok {
-			return nil, errors.New("cannot call non-callable object")
+			return nil, RuntimeError(NOT_CALLABLE_CODE, "cannot call non-callable object")
 		}
 
-		if len(ex.Args) != len(fn.Args) {
-			return nil, errors.New(fmt.Sprintf("expected %d args, found %d args",
-				len(fn.Args), len(ex.Args)))
-		}
-
-		before_call := self.scope
-		self.scope = fn.Context.NewChild()
+		args := make([]Object, len(ex.Args))
 		for i := 0; i < len(ex.Args); i++ {
 			obj, err := self.EvalExpression(ex.Args[i])
 			if err != nil {
 				return nil, err
 			}
-			self.scope.Init(fn.Args[i], obj)
-		}
-		cb, err := self.EvalStatementList(fn.Body)
-		self.scope = before_call
-		if err != nil {
-			return nil, err
-		}
-		switch cbv := cb.(type) {
-		case BREAK_CALLBACK:
-			return nil, errors.New("unexpected BREAK callback in function call")
-		case CONTINUE_CALLBACK:
-			return nil, errors.New("unexpected CONTINUE callback in function call")
-		case RETURN_CALLBACK:
-			return cbv.value, nil
+			args[i] = obj
 		}
-		return NULL{}, nil
+		return self.CallFrame(ex, fn, args)
 	case *FUNCTIONAL_EXPRESSION:
-		val := FUNCTION{ex.Args, ex.Body, self.scope}
+		val := FUNCTION{ex.Identifier, ex.Args, ex.Body, self.scope}
 		if len(ex.Identifier) > 0 {
-			self.scope.Init(ex.Identifier, val)
+			// named functions follow the rules of LET
+			if self.redefine && self.scope == self.globals {
+				self.scope.Define(ex.Identifier, val)
+			} else if err := self.scope.Init(ex.Identifier, val); err != nil {
+				return nil, err
+			}
 		}
 		return val, nil
 	case *UNARY_OPERATION_EXPRESSION:
@@ -286,6 +474,9 @@ func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, err
 		if err != nil {
 			return nil, err
 		}
+		if err := self.Allocate(ResultSize(ex.Operator, left, right)); err != nil {
+			return nil, err
+		}
 		return ApplyBinaryOperator(ex.Operator, left, right)
 	case *BINARY_ASSIGN_EXPRESSION:
 		right, err := self.EvalExpression(ex.Right)
@@ -293,19 +484,26 @@ func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, err
 			return nil, err
 		}
 		if len(ex.Operator) == 2 {
-			mainop := string([]rune(ex.Operator)[1])
+			mainop := string([]rune(ex.Operator)[0])
 			cur_val, err := self.scope.Get(ex.Left)
 			if err != nil {
+				return nil, self.ExplainUndefined(ex.Left, err)
+			}
+			if err := self.Allocate(ResultSize(mainop, cur_val, right)); err != nil {
 				return nil, err
 			}
 			obj, err := ApplyBinaryOperator(mainop, cur_val, right)
 			if err != nil {
 				return nil, err
 			}
-			self.scope.Set(ex.Left, obj)
+			if _, err := self.scope.Set(ex.Left, obj); err != nil {
+				return nil, self.ExplainUndefined(ex.Left, err)
+			}
 			return obj, nil
 		} else { // =
-			self.scope.Set(ex.Left, right)
+			if _, err := self.scope.Set(ex.Left, right); err != nil {
+				return nil, self.ExplainUndefined(ex.Left, err)
+			}
 			return right, nil
 		}
 	default:
@@ -316,41 +514,116 @@ func (self *Interpreter) EvalExpression(expression EXPRESSION_NODE) (Object, err
 func ApplyBinaryOperator(operator string, left, right Object) (Object, error) {
 	switch operator {
 	case "+":
-		if left.Typeof() == INTEGER_TYPE && right.Typeof() == INTEGER_TYPE {
-			return INT(left.(INT) + right.(INT)), nil
+		if l, ok := left.(STRING); ok {
+			if r, ok := right.(STRING); ok {
+				return l + r, nil
+			}
+		}
+		if l, ok := left.(ARRAY); ok {
+			if r, ok := right.(ARRAY); ok {
+				result := make(ARRAY, 0, len(l)+len(r))
+				return append(append(result, l...), r...), nil
+			}
+		}
+		return ApplyArithmeticOperator(operator, left, right)
+	case "-", "*", "/", "%":
+		return ApplyArithmeticOperator(operator, left, right)
+	case "==":
+		return BOOL(Equals(left, right)), nil
+	case "!=":
+		return BOOL(!Equals(left, right)), nil
+	case ">", "<", ">=", "<=":
+		var cmp int
+		if IsNumber(left) && IsNumber(right) {
+			result, ok := CompareNumbers(left, right)
+			if !ok {
+				return BOOL(false), nil
+			}
+			cmp = result
+		} else if l, ok := left.(STRING); ok && right.Typeof() == STRING_TYPE {
+			cmp = strings.Compare(string(l), string(right.(STRING)))
+		} else {
+			return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"%s\" operator for %s and %s",
+				operator, Typeof(left), Typeof(right))
 		}
-		if left.Typeof() == INTEGER_TYPE && right.Typeof() == FLOATING_TYPE {
-			return FLOAT(FLOAT(left.(INT)) + right.(FLOAT)), nil
+		switch operator {
+		case ">":
+			return BOOL(cmp > 0), nil
+		case "<":
+			return BOOL(cmp < 0), nil
+		case ">=":
+			return BOOL(cmp >= 0), nil
+		default:
+			return BOOL(cmp <= 0), nil
 		}
-		if left.Typeof() == FLOATING_TYPE && right.Typeof() == INTEGER_TYPE {
-			return FLOAT(left.(FLOAT) + FLOAT(right.(INT))), nil
+	case "&", "|":
+		l, lok := left.(BOOL)
+		r, rok := right.(BOOL)
+		if !lok || !rok {
+			return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"%s\" operator for %s and %s",
+				operator, Typeof(left), Typeof(right))
 		}
-
-		return nil, UNKNOWN_ERROR
+		if operator == "&" {
+			return l && r, nil
+		}
+		return l || r, nil
 	default:
 		return nil, UNKNOWN_ERROR
 	}
 }
 
+func Equals(left, right Object) bool {
+	if IsNumber(left) && IsNumber(right) {
+		cmp, ok := CompareNumbers(left, right)
+		return ok && cmp == 0
+	}
+	switch l := left.(type) {
+	case BOOL, STRING, NULL:
+		return left == right
+	case ARRAY:
+		r, ok := right.(ARRAY)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for i := range l {
+			if !Equals(l[i], r[i]) {
+				return false
+			}
+		}
+		return true
+	case MAP:
+		r, ok := right.(MAP)
+		if !ok || len(l) != len(r) {
+			return false
+		}
+		for key, val := range l {
+			if other, ok := r[key]; !ok || !Equals(val, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
 func ApplyUnaryOperator(operator string, obj Object) (Object, error) {
 	switch operator {
 	case "-":
-		switch t := obj.(type) {
-		case INT:
-			return -t, nil
-		case FLOAT:
-			return -t, nil
-		default:
-			return nil, errors.New(fmt.Sprintf("cannot apply \"-\" operator for %s",
-				Typeof(obj)))
+		return NegateNumber(obj)
+	case "+":
+		if !IsNumber(obj) {
+			return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"+\" operator for %s",
+				Typeof(obj))
 		}
+		return obj, nil
 	case "!":
 		switch t := obj.(type) {
 		case BOOL:
 			return !t, nil
 		default:
-			return nil, errors.New(fmt.Sprintf("cannot apply \"!\" operator for %s",
-				Typeof(obj)))
+			return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"!\" operator for %s",
+				Typeof(obj))
 		}
 	default:
 		return nil, UNKNOWN_ERROR
@@ -0,0 +1,32 @@
+package core
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRedefinition(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		{"fn f: { return 1 }\nfn f: { return 2 }", "", REDEFINITION_CODE},
+		{"let f = 1\nfn f: { return 2 }", "", REDEFINITION_CODE},
+		{"let x = 1\nlet x = 2", "", REDEFINITION_CODE},
+		// every call has a scope of its own
+		{"fn g: { fn h: { return 1 }\nreturn h() }\nsay g() + g()", "2", ""},
+	})
+
+	// a REPL may define globals again, but not locals
+	interpreter := NewInterpreter()
+	interpreter.AllowRedefinition(true)
+	for _, source := range []string{"fn f: { return 1 }", "fn f: { return 2 }", "let x = 1", "let x = 2"} {
+		if _, err := interpreter.Eval(source); err != nil {
+			t.Fatalf("%q failed: %s", source, err)
+		}
+	}
+	if result, err := interpreter.Eval("f() + x"); err != nil || result != INT(4) {
+		t.Errorf("f() + x = %v, %v, want 4", result, err)
+	}
+	_, err := interpreter.EvalContext(context.Background(), "fn g: { fn h: {}\nfn h: {} }\ng()")
+	if scriptErr, ok := AsScriptError(err); !ok || scriptErr.Code != REDEFINITION_CODE {
+		t.Errorf("redefining a local failed with %v, want %s", err, REDEFINITION_CODE)
+	}
+}
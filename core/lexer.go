@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"strings"
 	"unicode"
 )
@@ -8,28 +9,61 @@ import (
 type Lexer struct {
 	buffer       *LexerBuffer
 	current      *Token
+	previous     *Token
 	char         rune
 	line, column int
+	// "##" doc comment lines waiting for the next token
+	doc []string
+	// a line break was skipped since the last token
+	newline bool
+	// every comment read so far and the line the last token ended on
+	comments []Comment
+	lastLine int
 }
 
 // constructor
 func NewLexer(code string) *Lexer {
-	return &Lexer{
+	lexer := &Lexer{
 		buffer:  NewLexerBuffer(code),
 		current: nil,
 		line:    1,
 		column:  1,
 	}
+	lexer.SkipShebang()
+	return lexer
+}
+
+// skips a "#!/usr/bin/env ..." first line, so scripts can be executable
+func (self *Lexer) SkipShebang() {
+	if self.buffer.PeekAt(0) == '#' && self.buffer.PeekAt(1) == '!' {
+		self.ReadWhile(func(r rune) bool {
+			return r != '\n'
+		})
+	}
 }
 
 // help functions
 func (self *Lexer) NewToken(tokenType TokenType, literal string) *Token {
-	return &Token{
-		Type:    tokenType,
-		Literal: literal,
-		Line:    self.line,
-		Column:  self.column,
+	token := &Token{
+		Type:          tokenType,
+		Literal:       literal,
+		Line:          self.line,
+		Column:        self.column,
+		Doc:           strings.Join(self.doc, "\n"),
+		NewlineBefore: self.newline,
 	}
+	token.EndLine, token.EndColumn = self.buffer.Pos()
+	self.lastLine = token.EndLine
+	self.doc = nil
+	self.newline = false
+	return token
+}
+
+func (self *Lexer) NewIllegalToken(literal, code, reason string) *Token {
+	token := self.NewToken(ILLEGAL_TOKEN, literal)
+	token.ErrorCode = code
+	token.Error = reason
+	return token
 }
 
 func (self *Lexer) ReadWhile(predicate func(rune) bool) string {
@@ -48,22 +82,157 @@ func (self *Lexer) ReadString() string {
 	return str
 }
 
-func (self *Lexer) ReadNumber() *Token {
-	part := func() string {
-		return self.ReadWhile(func(r rune) bool {
-			return unicode.IsDigit(r)
-		})
-	}
+func IsDecimalDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func IsHexDigit(r rune) bool {
+	return IsDecimalDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func IsOctalDigit(r rune) bool {
+	return r >= '0' && r <= '7'
+}
+
+func IsBinaryDigit(r rune) bool {
+	return r == '0' || r == '1'
+}
 
+// digits may be separated by single underscores: 1_000_000
+func (self *Lexer) ReadDigits(isDigit func(rune) bool) string {
+	return self.ReadWhile(func(r rune) bool {
+		return isDigit(r) || r == '_'
+	})
+}
+
+func (self *Lexer) ReadNumber() *Token {
 	var number strings.Builder
 	number.WriteRune(self.char)
-	number.WriteString(part())
-	if self.buffer.NextIf('.') {
-		number.WriteRune('.')
-		number.WriteString(part())
-		return self.NewToken(FLOAT_TOKEN, number.String())
+
+	// prefixed integers: 0xFF, 0o17, 0b1010
+	if self.char == '0' && strings.ContainsRune("xXoObB", self.buffer.Peek()) {
+		prefix := self.buffer.Next()
+		number.WriteRune(prefix)
+		var isDigit func(rune) bool
+		var name string
+		switch unicode.ToLower(prefix) {
+		case 'x':
+			isDigit, name = IsHexDigit, "hexadecimal"
+		case 'o':
+			isDigit, name = IsOctalDigit, "octal"
+		default:
+			isDigit, name = IsBinaryDigit, "binary"
+		}
+		digits := self.ReadDigits(isDigit)
+		number.WriteString(digits)
+		if strings.Trim(digits, "_") == "" {
+			return self.ReadMalformedNumber(number.String(),
+				fmt.Sprintf("%s literal has no digits", name))
+		}
+		if !ValidSeparators("0"+digits, isDigit) {
+			return self.ReadMalformedNumber(number.String(), "invalid digit separator")
+		}
+		return self.FinishNumber(INT_TOKEN, number.String())
+	}
+
+	tokenType := INT_TOKEN
+	if self.char != '.' {
+		number.WriteString(self.ReadDigits(IsDecimalDigit))
+		if self.buffer.NextIf('.') {
+			number.WriteRune('.')
+			tokenType = FLOAT_TOKEN
+		}
+	} else {
+		// leading-dot float: .5
+		tokenType = FLOAT_TOKEN
+	}
+	if tokenType == FLOAT_TOKEN {
+		number.WriteString(self.ReadDigits(IsDecimalDigit))
+		if self.buffer.Peek() == '.' {
+			number.WriteString(self.ReadWhile(func(r rune) bool {
+				return IsDecimalDigit(r) || r == '.' || r == '_'
+			}))
+			return self.ReadMalformedNumber(number.String(), "too many decimal points")
+		}
+	}
+
+	// scientific notation: 1.5e-3
+	exponent := false
+	if next := self.buffer.Peek(); next == 'e' || next == 'E' {
+		exponent = true
+		tokenType = FLOAT_TOKEN
+		number.WriteRune(self.buffer.Next())
+		if next := self.buffer.Peek(); next == '+' || next == '-' {
+			number.WriteRune(self.buffer.Next())
+		}
+		digits := self.ReadDigits(IsDecimalDigit)
+		number.WriteString(digits)
+		if strings.Trim(digits, "_") == "" {
+			return self.ReadMalformedNumber(number.String(), "exponent has no digits")
+		}
+	}
+
+	if tokenType == INT_TOKEN && self.buffer.Peek() == '/' && self.IsRationalDenominator() {
+		// rational literal: 1/3r
+		number.WriteRune(self.buffer.Next())
+		number.WriteString(self.ReadDigits(IsDecimalDigit))
+	}
+
+	if !ValidSeparators(number.String(), IsDecimalDigit) {
+		return self.ReadMalformedNumber(number.String(), "invalid digit separator")
 	}
-	return self.NewToken(INT_TOKEN, number.String())
+
+	// exact number suffixes: 1.10d, 3r, 1/3r
+	if !exponent && self.buffer.NextIf('d') {
+		number.WriteRune('d')
+		tokenType = DECIMAL_TOKEN
+	} else if !exponent && self.buffer.NextIf('r') {
+		number.WriteRune('r')
+		tokenType = RATIONAL_TOKEN
+	}
+	return self.FinishNumber(tokenType, number.String())
+}
+
+// a number must not run straight into a word or another number: 12abc, 0b102
+func (self *Lexer) FinishNumber(tokenType TokenType, literal string) *Token {
+	next := self.buffer.Peek()
+	if unicode.IsLetter(next) || unicode.IsDigit(next) || next == '_' || next == '.' {
+		return self.ReadMalformedNumber(literal, "invalid character in number literal")
+	}
+	return self.NewToken(tokenType, literal)
+}
+
+// consumes the rest of a malformed number, so the error covers all of it
+func (self *Lexer) ReadMalformedNumber(literal, reason string) *Token {
+	literal += self.ReadWhile(func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+	})
+	return self.NewIllegalToken(literal, MALFORMED_NUMBER_CODE,
+		fmt.Sprintf("malformed number literal \"%s\": %s", literal, reason))
+}
+
+// underscores are only allowed between two digits
+func ValidSeparators(literal string, isDigit func(rune) bool) bool {
+	runes := []rune(literal)
+	for i, r := range runes {
+		if r != '_' {
+			continue
+		}
+		if i == 0 || i == len(runes)-1 ||
+			!isDigit(runes[i-1]) || !isDigit(runes[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// checks if buffer is at "/<digits>r", without consuming anything
+func (self *Lexer) IsRationalDenominator() bool {
+	offset := 1
+	for IsDecimalDigit(self.buffer.PeekAt(offset)) || self.buffer.PeekAt(offset) == '_' {
+		offset++
+	}
+	return offset > 1 && self.buffer.PeekAt(offset) == 'r'
 }
 
 func (self *Lexer) ReadWord() *Token {
@@ -77,17 +246,59 @@ func (self *Lexer) ReadWord() *Token {
 		return self.NewToken(BOOL_TOKEN, word)
 	case "null":
 		return self.NewToken(NULL_TOKEN, word)
-	case "let", "break", "continue", "return",
-		"for", "if", "else", "fn", "lambda", "say":
-		return self.NewToken(KEYWORD_TOKEN, word)
 	default:
+		if Includes(KEYWORDS, word) {
+			return self.NewToken(KEYWORD_TOKEN, word)
+		}
 		return self.NewToken(ID_TOKEN, word)
 	}
 }
 
+// records a comment that started at the current token position and
+// ends at the buffer position
+func (self *Lexer) AddComment(text string) {
+	endLine, endColumn := self.buffer.Pos()
+	self.comments = append(self.comments, Comment{
+		Text:     text,
+		Start:    Position{self.line, self.column},
+		End:      Position{endLine, endColumn},
+		Trailing: self.lastLine == self.line,
+	})
+}
+
+// comments read so far, in source order
+func (self *Lexer) Comments() []Comment {
+	return self.comments
+}
+
+// skips the rest of a /* */ comment, the opening "/*" is already consumed
+func (self *Lexer) SkipBlockComment() bool {
+	depth := 1
+	for depth > 0 {
+		if self.buffer.Eof() {
+			return false
+		}
+		char := self.buffer.Next()
+		if char == '/' && self.buffer.NextIf('*') {
+			depth++
+		} else if char == '*' && self.buffer.NextIf('/') {
+			depth--
+		}
+	}
+	return true
+}
+
+var KEYWORDS = []string{
+	"let", "break", "continue", "return",
+	"for", "if", "else", "fn", "lambda", "say",
+}
+
 // main function
 func (self *Lexer) ReadToken() *Token {
 	self.ReadWhile(func(r rune) bool {
+		if r == '\n' {
+			self.newline = true
+		}
 		return unicode.IsSpace(r)
 	})
 
@@ -98,17 +309,37 @@ func (self *Lexer) ReadToken() *Token {
 	//end of file
 	case rune(0):
 		return self.NewToken(EOF_TOKEN, "")
-	// one line comment
+	// one line comment, "##" starts a doc comment
 	case '#':
-		self.ReadWhile(func(r rune) bool {
+		start := self.buffer.Offset() - 1
+		isDoc := self.buffer.NextIf('#')
+		text := self.ReadWhile(func(r rune) bool {
 			return r != '\n'
 		})
+		self.AddComment(strings.TrimRight(self.buffer.Slice(start, self.buffer.Offset()), "\r"))
+		if isDoc {
+			text = strings.TrimSuffix(text, "\r")
+			self.doc = append(self.doc, strings.TrimPrefix(text, " "))
+		}
 		return self.ReadToken()
 	// punctuation
 	case '(', ')', '{', '}', ';', ',', ':', '[', ']':
 		return self.NewToken(PUNC_TOKEN, string(self.char))
 	//operators
 	case '+', '-', '*', '/', '%', '=', '!', '>', '<', '&', '|':
+		// block comment, may be nested
+		if self.char == '/' && self.buffer.NextIf('*') {
+			start := self.buffer.Offset() - 2
+			if !self.SkipBlockComment() {
+				return self.NewIllegalToken("/*", UNTERMINATED_COMMENT_CODE, "unterminated block comment")
+			}
+			self.AddComment(self.buffer.Slice(start, self.buffer.Offset()))
+			// a comment spanning lines separates statements like a newline
+			if line, _ := self.buffer.Pos(); line != self.line {
+				self.newline = true
+			}
+			return self.ReadToken()
+		}
 		if self.buffer.NextIf('=') {
 			return self.NewToken(OP_TOKEN, string([]rune{self.char, '='}))
 		}
@@ -122,14 +353,15 @@ func (self *Lexer) ReadToken() *Token {
 			return self.ReadWord()
 		}
 		//number
-		if unicode.IsDigit(self.char) {
+		if IsDecimalDigit(self.char) || (self.char == '.' && IsDecimalDigit(self.buffer.Peek())) {
 			return self.ReadNumber()
 		}
 		// unknown, illegal token
 		illegalLiteral := string(self.char) + self.ReadWhile(func(r rune) bool {
 			return !unicode.IsSpace(r)
 		})
-		return self.NewToken(ILLEGAL_TOKEN, illegalLiteral)
+		return self.NewIllegalToken(illegalLiteral, ILLEGAL_CHARACTER_CODE,
+			fmt.Sprintf("unknown character \"%c\"", self.char))
 	}
 }
 
@@ -144,15 +376,31 @@ func (self *Lexer) Peek() *Token {
 func (self *Lexer) Next() *Token {
 	current := self.Peek()
 	self.current = nil
+	self.previous = current
 	return current
 }
 
+// the last token returned by Next, nil before the first one
+func (self *Lexer) Previous() *Token {
+	return self.previous
+}
+
+// puts the last token returned by Next back, only possible right after
+// Next. Previous is unknown afterwards
+func (self *Lexer) Backup() bool {
+	if self.current != nil || self.previous == nil {
+		return false
+	}
+	self.current, self.previous = self.previous, nil
+	return true
+}
+
 func (self *Lexer) Eof() bool {
 	return self.Peek().Type == EOF_TOKEN
 }
 
 func (self *Lexer) NextIf(expected string) bool {
-	if self.Peek().Literal == expected {
+	if self.Peek().Symbol() == expected {
 		self.Next()
 		return true
 	}
@@ -0,0 +1,257 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Each limit fails with its own error, hosts can tell them apart
+// with errors.Is
+var (
+	ErrCancelled           = errors.New("execution cancelled")
+	ErrTimeout             = errors.New("execution timed out")
+	ErrStepLimitExceeded   = errors.New("step limit exceeded")
+	ErrCallDepthExceeded   = errors.New("maximum call depth exceeded")
+	ErrMemoryLimitExceeded = errors.New("memory limit exceeded")
+)
+
+// deep enough for any sane recursion, shallow enough for the Go stack
+const DEFAULT_MAX_CALL_DEPTH = 10000
+
+// the context is polled once per this many steps
+const CONTEXT_CHECK_INTERVAL = 256
+
+// maximum number of statements and loop iterations per run, 0 means no limit
+func (self *Interpreter) SetMaxSteps(steps int) {
+	self.maxSteps = steps
+}
+
+// maximum number of nested function calls, 0 means no limit
+func (self *Interpreter) SetMaxCallDepth(depth int) {
+	self.maxCallDepth = depth
+}
+
+// allocation budget per run in bytes, 0 means no limit. It caps the
+// bytes allocated for STRING, ARRAY, MAP and big number values over the
+// whole run, not the memory live at one time: a value that is dropped
+// again stays counted. The sizes are approximate, see SizeOf
+func (self *Interpreter) SetAllocationBudget(bytes int) {
+	self.allocationBudget = bytes
+}
+
+// wall-clock limit per run, 0 means no limit
+func (self *Interpreter) SetTimeout(timeout time.Duration) {
+	self.timeout = timeout
+}
+
+// runs body with the limits applied, nested runs
+// (e.g. a builtin calling Eval) share the limits of the outer one
+func (self *Interpreter) run(ctx context.Context, body func() error) error {
+	if self.ctx != nil {
+		return body()
+	}
+
+	self.parentCtx = ctx
+	if self.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.timeout)
+		defer cancel()
+	}
+	self.ctx = ctx
+	self.steps = 0
+	self.allocated = 0
+	defer func() {
+		self.ctx, self.parentCtx = nil, nil
+		self.scope = self.globals
+		self.callDepth = 0
+		self.frames = nil
+		self.callers = nil
+		self.blocks = nil
+	}()
+
+	if err := self.checkContext(); err != nil {
+		return err
+	}
+	err := body()
+	settle(err)
+	return err
+}
+
+// counts one unit of work against the limits
+func (self *Interpreter) Step() error {
+	self.steps++
+	if self.maxSteps > 0 && self.steps > self.maxSteps {
+		return fmt.Errorf("%w: maximum is %d steps", ErrStepLimitExceeded, self.maxSteps)
+	}
+	if self.steps%CONTEXT_CHECK_INTERVAL == 0 {
+		return self.checkContext()
+	}
+	return nil
+}
+
+func (self *Interpreter) checkContext() error {
+	if self.ctx == nil {
+		return nil
+	}
+	select {
+	case <-self.ctx.Done():
+	default:
+		return nil
+	}
+	// our own deadline expired, not the one of the caller
+	if self.parentCtx.Err() == nil {
+		return &contextError{ErrTimeout, self.ctx.Err(),
+			fmt.Sprintf("%s after %s", ErrTimeout, self.timeout)}
+	}
+	return &contextError{ErrCancelled, self.parentCtx.Err(),
+		fmt.Sprintf("%s: %s", ErrCancelled, self.parentCtx.Err())}
+}
+
+// a run stopped by its context, errors.Is finds both the limit and the
+// error of the context, e.g. ErrCancelled and context.Canceled
+type contextError struct {
+	limit   error
+	cause   error
+	message string
+}
+
+func (self *contextError) Error() string {
+	return self.message
+}
+
+func (self *contextError) Is(target error) bool {
+	return target == self.limit
+}
+
+func (self *contextError) Unwrap() error {
+	return self.cause
+}
+
+// counts bytes about to be allocated against the allocation budget,
+// builtins creating big values should call it before allocating. Nothing
+// is ever given back, see SetAllocationBudget
+func (self *Interpreter) Allocate(bytes int) error {
+	if bytes <= 0 {
+		return nil
+	}
+	self.allocated += bytes
+	if self.allocationBudget > 0 && self.allocated > self.allocationBudget {
+		return fmt.Errorf("%w: the run allocated more than its budget of %d bytes",
+			ErrMemoryLimitExceeded, self.allocationBudget)
+	}
+	return nil
+}
+
+// bytes the run may still allocate, -1 if there is no budget
+func (self *Interpreter) RemainingAllocation() int {
+	if self.allocationBudget <= 0 {
+		return -1
+	}
+	return maxOf(self.allocationBudget-self.allocated, 0)
+}
+
+// approximate sizes of values on a 64 bit platform
+const (
+	OBJECT_SIZE    = 16 // interface value
+	STRING_SIZE    = 16 // string header
+	ARRAY_SIZE     = 24 // slice header
+	MAP_SIZE       = 48
+	MAP_ENTRY_SIZE = STRING_SIZE + OBJECT_SIZE
+	BIG_SIZE       = 32 // big.Int
+)
+
+func StringSize(length int) int {
+	return STRING_SIZE + length
+}
+
+func ArraySize(length int) int {
+	return ARRAY_SIZE + length*OBJECT_SIZE
+}
+
+// bytes held by obj itself, not counting the elements it refers to
+func SizeOf(obj Object) int {
+	switch t := obj.(type) {
+	case STRING:
+		return StringSize(len(t))
+	case ARRAY:
+		return ArraySize(len(t))
+	case MAP:
+		size := MAP_SIZE + len(t)*MAP_ENTRY_SIZE
+		for key := range t {
+			size += len(key)
+		}
+		return size
+	default:
+		return OBJECT_SIZE
+	}
+}
+
+// bytes a binary operator will allocate: concatenation and arithmetic
+// with a BIGINT, DECIMAL or RATIONAL operand allocate
+func ResultSize(operator string, left, right Object) int {
+	switch l := left.(type) {
+	case STRING:
+		if r, ok := right.(STRING); ok && operator == "+" {
+			return StringSize(len(l) + len(r))
+		}
+	case ARRAY:
+		if r, ok := right.(ARRAY); ok && operator == "+" {
+			return ArraySize(len(l) + len(r))
+		}
+	}
+	if !strings.Contains("+-*/%", operator) || !IsNumber(left) || !IsNumber(right) ||
+		!(isBig(left) || isBig(right)) {
+		return 0
+	}
+	bits := NumberBits(left) + NumberBits(right)
+	if IsInteger(left) && IsInteger(right) {
+		switch operator {
+		case "+", "-":
+			bits = maxOf(NumberBits(left), NumberBits(right)) + 1
+		case "/", "%":
+			bits = NumberBits(left)
+		}
+	}
+	return BIG_SIZE + bits/8 + 1
+}
+
+func isBig(obj Object) bool {
+	switch obj.(type) {
+	case BIGINT, DECIMAL, RATIONAL:
+		return true
+	default:
+		return false
+	}
+}
+
+// bits of the digits of a number, a DECIMAL scale counts 4 bits a digit
+func NumberBits(obj Object) int {
+	switch t := obj.(type) {
+	case BIGINT:
+		return t.Value.BitLen()
+	case DECIMAL:
+		return t.Unscaled.BitLen() + 4*t.Scale
+	case RATIONAL:
+		return t.Value.Num().BitLen() + t.Value.Denom().BitLen()
+	default:
+		return 64
+	}
+}
+
+func maxOf(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// context of the current run, for builtins doing blocking work
+func (self *Interpreter) Context() context.Context {
+	if self.ctx == nil {
+		return context.Background()
+	}
+	return self.ctx
+}
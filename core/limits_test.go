@@ -0,0 +1,175 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func runLimited(t *testing.T, interpreter *Interpreter, source string) error {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter.SetAllocationBudget(1 << 20)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return interpreter.Interpret(ctx, program)
+}
+
+func TestMemoryLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+	}{
+		{"string", "let s = \"x\"\nfor true { s = s + s }"},
+		{"array", "let a = [1]\nfor true { a = a + a }"},
+		{"bigint", "let x = 3\nfor true { x = x * x }"},
+		{"compound bigint", "let x = 3\nfor true { x *= x }"},
+		{"rational", "let x = 1/3r\nfor true { x = x * x }"},
+		{"decimal", "let x = 1.5d\nfor true { x = x * 12345678901234567890d }"},
+	}
+	for _, test := range tests {
+		err := runLimited(t, NewInterpreter(), test.source)
+		if !errors.Is(err, ErrMemoryLimitExceeded) {
+			t.Errorf("%s: got %v, want the memory limit", test.name, err)
+		}
+	}
+}
+
+func TestMemoryLimitOfInput(t *testing.T) {
+	interpreter := NewInterpreter()
+	interpreter.SetStdin(strings.NewReader(strings.Repeat("x", 2<<20) + "\n"))
+	err := runLimited(t, interpreter, "let line = readline()")
+	if !errors.Is(err, ErrMemoryLimitExceeded) {
+		t.Errorf("got %v, want the memory limit", err)
+	}
+
+	interpreter = NewInterpreter()
+	interpreter.SetStdin(strings.NewReader("short\n"))
+	if err := runLimited(t, interpreter, "let line = readline()"); err != nil {
+		t.Errorf("reading a short line: %s", err)
+	}
+}
+
+func TestMemoryLimitOfExec(t *testing.T) {
+	if _, err := exec.LookPath("yes"); err != nil {
+		t.Skip("yes is not installed")
+	}
+	interpreter := NewInterpreter()
+	interpreter.SetPolicy(AllowAllPolicy())
+	err := runLimited(t, interpreter, "let out = exec(\"yes\")")
+	if !errors.Is(err, ErrMemoryLimitExceeded) {
+		t.Errorf("got %v, want the memory limit", err)
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		// applies the limit
+		setup func(*Interpreter) (context.Context, context.CancelFunc)
+		// errors.Is must match every one of these
+		errs []error
+		code string
+	}{
+		{"timeout", "for true {}", func(interpreter *Interpreter) (context.Context, context.CancelFunc) {
+			interpreter.SetTimeout(20 * time.Millisecond)
+			return context.WithCancel(context.Background())
+		}, []error{ErrTimeout, context.DeadlineExceeded}, TIMEOUT_CODE},
+		{"cancel", "for true {}", func(interpreter *Interpreter) (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(20*time.Millisecond, cancel)
+			return ctx, cancel
+		}, []error{ErrCancelled, context.Canceled}, CANCELLED_CODE},
+		{"deadline of the caller", "for true {}", func(interpreter *Interpreter) (context.Context, context.CancelFunc) {
+			interpreter.SetTimeout(time.Minute)
+			return context.WithTimeout(context.Background(), 20*time.Millisecond)
+		}, []error{ErrCancelled, context.DeadlineExceeded}, CANCELLED_CODE},
+		{"max steps", "let i = 0\nfor i < 100 { i += 1 }", func(interpreter *Interpreter) (context.Context, context.CancelFunc) {
+			interpreter.SetMaxSteps(50)
+			return context.WithCancel(context.Background())
+		}, []error{ErrStepLimitExceeded}, STEP_LIMIT_CODE},
+		{"call depth", "fn f: n { return f(n + 1) }\nf(0)", func(interpreter *Interpreter) (context.Context, context.CancelFunc) {
+			interpreter.SetMaxCallDepth(100)
+			return context.WithCancel(context.Background())
+		}, []error{ErrCallDepthExceeded}, CALL_DEPTH_CODE},
+	}
+	for _, test := range tests {
+		program, err := NewParser(test.source).ParseProgram()
+		if err != nil {
+			t.Fatal(err)
+		}
+		interpreter := NewInterpreter()
+		ctx, cancel := test.setup(interpreter)
+		err = interpreter.Interpret(ctx, program)
+		cancel()
+		for _, want := range test.errs {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: got %v, want errors.Is %v", test.name, err, want)
+			}
+		}
+		if code := CodeOf(err); code != test.code {
+			t.Errorf("%s: got the code %s, want %s", test.name, code, test.code)
+		}
+	}
+
+	// limits under the ones set pass
+	interpreter := NewInterpreter()
+	interpreter.SetMaxSteps(10000)
+	interpreter.SetMaxCallDepth(100)
+	interpreter.SetTimeout(time.Minute)
+	if err := runLimited(t, interpreter, "fn f: n { if n > 0 { return f(n - 1) }\nreturn 0 }\nlet i = 0\nfor i < 10 { i += f(50) + 1 }"); err != nil {
+		t.Errorf("running within the limits: %s", err)
+	}
+}
+
+func TestMemoryLimitOfFiles(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 100; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("%04d%s", i, strings.Repeat("x", 200)))
+		if err := ioutil.WriteFile(name, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name   string
+		source string
+	}{
+		// the size of a device is 0, reading it never ends
+		{"device", "let data = read_file(\"/dev/zero\")"},
+		// the names count, not only the array
+		{"directory", "let names = list_dir(\"" + dir + "\")"},
+	}
+	for _, test := range tests {
+		interpreter := NewInterpreter()
+		interpreter.SetPolicy(AllowAllPolicy())
+		interpreter.SetAllocationBudget(10000)
+		_, err := runWithPolicy(t, interpreter, test.source)
+		if !errors.Is(err, ErrMemoryLimitExceeded) {
+			t.Errorf("%s: got %v, want the memory limit", test.name, err)
+		}
+	}
+}
+
+func TestReadFileWithinBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "small")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter()
+	interpreter.SetPolicy(AllowAllPolicy())
+	interpreter.SetAllocationBudget(StringSize(5))
+	output, err := runWithPolicy(t, interpreter, "say read_file(\""+path+"\")")
+	if err != nil || output != "hello\n" {
+		t.Errorf("printed %q, %v, want hello", output, err)
+	}
+}
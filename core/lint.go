@@ -0,0 +1,191 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Static checks over the AST, see Lint. The checks run while the names
+// are resolved, see Resolve. Every rule can be turned off in LintConfig,
+// names starting with "_" are never reported as unused
+
+const (
+	UNUSED_VARIABLE_RULE        = "unused-variable"
+	UNUSED_PARAMETER_RULE       = "unused-parameter"
+	SHADOWED_NAME_RULE          = "shadowed-name"
+	UNREACHABLE_CODE_RULE       = "unreachable-code"
+	CONSTANT_CONDITION_RULE     = "constant-condition"
+	USE_BEFORE_DECLARATION_RULE = "use-before-declaration"
+	UNDECLARED_ASSIGNMENT_RULE  = "undeclared-assignment"
+	UNDEFINED_NAME_RULE         = "undefined-name"
+)
+
+var LINT_RULES = []string{
+	UNUSED_VARIABLE_RULE,
+	UNUSED_PARAMETER_RULE,
+	SHADOWED_NAME_RULE,
+	UNREACHABLE_CODE_RULE,
+	CONSTANT_CONDITION_RULE,
+	USE_BEFORE_DECLARATION_RULE,
+	UNDECLARED_ASSIGNMENT_RULE,
+	UNDEFINED_NAME_RULE,
+}
+
+type Severity string
+
+const (
+	WARNING_SEVERITY Severity = "warning"
+	// the script fails at runtime when it gets there
+	ERROR_SEVERITY Severity = "error"
+)
+
+func RuleSeverity(rule string) Severity {
+	switch rule {
+	case USE_BEFORE_DECLARATION_RULE, UNDECLARED_ASSIGNMENT_RULE, UNDEFINED_NAME_RULE:
+		return ERROR_SEVERITY
+	default:
+		return WARNING_SEVERITY
+	}
+}
+
+type LintIssue struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Start    Position `json:"start"`
+	End      Position `json:"end"`
+}
+
+func NewLintIssue(rule string, span Span, format string, args ...interface{}) LintIssue {
+	return LintIssue{
+		Rule:     rule,
+		Severity: RuleSeverity(rule),
+		Message:  fmt.Sprintf(format, args...),
+		Start:    span.Start,
+		End:      span.End,
+	}
+}
+
+// LintConfig turns rules on and off, rules missing from Rules are on.
+// Globals are names the host defines besides the builtins, e.g. "args"
+type LintConfig struct {
+	Rules   map[string]bool `json:"rules"`
+	Globals []string        `json:"globals"`
+}
+
+func DefaultLintConfig() LintConfig {
+	return LintConfig{Rules: make(map[string]bool)}
+}
+
+func (self LintConfig) Enabled(rule string) bool {
+	enabled, ok := self.Rules[rule]
+	return !ok || enabled
+}
+
+// Lint checks a parsed program, issues are sorted by position.
+// ERROR_STATEMENTs of a partial AST are skipped
+func Lint(program []STATEMENT_NODE, config LintConfig) []LintIssue {
+	return Resolve(program, config.Globals).Issues(config)
+}
+
+// the lint issues found while resolving, for the rules config enables
+func (self *Resolution) Issues(config LintConfig) []LintIssue {
+	issues := []LintIssue{}
+	for _, issue := range self.issues {
+		if config.Enabled(issue.Rule) {
+			issues = append(issues, issue)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return Before(issues[i].Start, issues[j].Start)
+	})
+	return issues
+}
+
+// checks if control never gets past statement
+func Terminates(statement STATEMENT_NODE) bool {
+	switch st := statement.(type) {
+	case *RETURN_STATEMENT, *BREAK_STATEMENT, *CONTINUE_STATEMENT:
+		return true
+	case *IF_STATEMENT:
+		return st.Els != nil && ListTerminates(st.Then) && ListTerminates(st.Els)
+	default:
+		return false
+	}
+}
+
+func ListTerminates(list []STATEMENT_NODE) bool {
+	for _, statement := range list {
+		if Terminates(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+// the value of a condition that does not depend on anything
+func ConstantCondition(expression EXPRESSION_NODE) (bool, bool) {
+	switch ex := expression.(type) {
+	case *PRIMITIVE_LITERAL_EXPRESSION:
+		value, ok := ex.Value.(bool)
+		return value, ok
+	case *UNARY_OPERATION_EXPRESSION:
+		value, ok := ConstantCondition(ex.Expression)
+		return !value, ok && ex.Operator == "!"
+	case *BINARY_EXPRESSION:
+		left, lok := ConstantCondition(ex.Left)
+		right, rok := ConstantCondition(ex.Right)
+		if !lok || !rok {
+			return false, false
+		}
+		switch ex.Operator {
+		case "&":
+			return left && right, true
+		case "|":
+			return left || right, true
+		case "==":
+			return left == right, true
+		case "!=":
+			return left != right, true
+		}
+	}
+	return false, false
+}
+
+// checks if a loop body can leave the loop: a break outside of nested
+// loops or a return
+func Escapes(list []STATEMENT_NODE) bool {
+	for _, statement := range list {
+		switch st := statement.(type) {
+		case *BREAK_STATEMENT, *RETURN_STATEMENT:
+			return true
+		case *IF_STATEMENT:
+			if Escapes(st.Then) || Escapes(st.Els) {
+				return true
+			}
+		case *FOR_STATEMENT:
+			if Returns(st.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func Returns(list []STATEMENT_NODE) bool {
+	for _, statement := range list {
+		switch st := statement.(type) {
+		case *RETURN_STATEMENT:
+			return true
+		case *IF_STATEMENT:
+			if Returns(st.Then) || Returns(st.Els) {
+				return true
+			}
+		case *FOR_STATEMENT:
+			if Returns(st.Body) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// "line:column rule" of every issue found in source
+func lintIssues(t *testing.T, source string, config LintConfig) []string {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatalf("parsing %q: %s", source, err)
+	}
+	issues := []string{}
+	for _, issue := range Lint(program, config) {
+		issues = append(issues, fmt.Sprintf("%d:%d %s", issue.Start.Line, issue.Start.Column, issue.Rule))
+	}
+	return issues
+}
+
+func TestLintRules(t *testing.T) {
+	tests := []struct {
+		source string
+		issues []string
+	}{
+		{"let x = 1", []string{"1:5 unused-variable"}},
+		{"let _x = 1", nil},
+		{"fn f: a { return 1 }\nf(1)", []string{"1:7 unused-parameter"}},
+		{"let x = 1\nif x > 0 { let x = 2\nsay x }", []string{"2:16 shadowed-name"}},
+		// the reads before the inner LET are of the outer x
+		{"let x = 1\nif x > 0 { say x\nlet x = x + 1\nsay x }", []string{"3:5 shadowed-name"}},
+		{"let x = 1\nfn f: { say x\nlet x = 2\nsay x }\nf()", []string{"3:5 shadowed-name"}},
+		// a later global is only shadowed by a function body
+		{"if 1 > 0 { let x = 1\nsay x }\nlet x = 2\nsay x", nil},
+		{"fn f: { let x = 1\nreturn x }\nlet x = 2\nsay x + f()", []string{"1:13 shadowed-name"}},
+		{"fn f: { return 1\nsay 2 }\nf()", []string{"2:1 unreachable-code"}},
+		{"if true { say 1 }", []string{"1:4 constant-condition"}},
+		{"for false { say 1 }", []string{"1:1 constant-condition"}},
+		{"for true { say 1 }", []string{"1:1 constant-condition"}},
+		{"for true { break }", nil},
+		{"say x\nlet x = 1", []string{"1:5 use-before-declaration"}},
+		{"if 1 > 0 { say x }\nlet x = 1\nsay x", []string{"1:16 use-before-declaration"}},
+		{"if 1 > 0 { say x\nlet x = 1\nsay x }", []string{"1:16 use-before-declaration"}},
+		// a function body runs later
+		{"fn f: { return g() }\nfn g: { return 1 }\nsay f()", nil},
+		{"x = 1", []string{"1:1 undeclared-assignment"}},
+		{"say y", []string{"1:5 undefined-name"}},
+		{"say len([])", nil},
+		// the test command calls the tests
+		{"fn test_a: {}", nil},
+	}
+	for _, test := range tests {
+		issues := lintIssues(t, test.source, DefaultLintConfig())
+		if strings.Join(issues, ", ") != strings.Join(test.issues, ", ") {
+			t.Errorf("%q has issues %v, want %v", test.source, issues, test.issues)
+		}
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	source := "let x = 1\nsay args"
+	if issues := lintIssues(t, source, DefaultLintConfig()); len(issues) != 2 {
+		t.Errorf("default config found %v", issues)
+	}
+	config := LintConfig{Rules: map[string]bool{UNUSED_VARIABLE_RULE: false}, Globals: []string{"args"}}
+	if issues := lintIssues(t, source, config); len(issues) != 0 {
+		t.Errorf("found %v with the rule off and args defined", issues)
+	}
+}
+
+// uses bind to the declaration in scope at that point of the source
+func TestResolveScopes(t *testing.T) {
+	source := "let x = 1\nif x > 0 {\n    say x\n    let x = x + 1\n    say x\n}"
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolution := Resolve(program, nil)
+	tests := []struct {
+		use         Position
+		declaration Position
+	}{
+		{Position{2, 4}, Position{1, 5}},
+		{Position{3, 9}, Position{1, 5}},
+		{Position{4, 13}, Position{1, 5}},
+		{Position{5, 9}, Position{4, 9}},
+	}
+	for _, test := range tests {
+		symbol := resolution.SymbolAt(test.use)
+		if symbol == nil || symbol.Span.Start != test.declaration {
+			t.Errorf("x %s resolved to %v, want the declaration %s", test.use.Format(), symbol, test.declaration.Format())
+		}
+	}
+}
@@ -0,0 +1,435 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var DIVISION_BY_ZERO_ERROR error = errors.New("division by zero")
+
+const (
+	maxInt = 1<<(strconv.IntSize-1) - 1
+	minInt = -1 << (strconv.IntSize - 1)
+)
+
+// integers that do not fit into INT are promoted to BIGINT,
+// BIGINT values that fit into INT are demoted back
+func NormalizeInteger(value *big.Int) Object {
+	if fitsInt(value) {
+		return INT(value.Int64())
+	}
+	return BIGINT{value}
+}
+
+func fitsInt(value *big.Int) bool {
+	return value.IsInt64() &&
+		value.Int64() >= minInt && value.Int64() <= maxInt
+}
+
+func IsInteger(obj Object) bool {
+	switch obj.(type) {
+	case INT, BIGINT:
+		return true
+	default:
+		return false
+	}
+}
+
+func IsNumber(obj Object) bool {
+	switch obj.(type) {
+	case INT, BIGINT, DECIMAL, RATIONAL, FLOAT:
+		return true
+	default:
+		return false
+	}
+}
+
+// Promotion rules: when operands of different numeric types meet,
+// the one with the lower rank is converted to the type of the other.
+// INT and BIGINT -> DECIMAL -> RATIONAL -> FLOAT,
+// except that mixing DECIMAL and FLOAT is an error, because silently
+// losing exactness is exactly what DECIMAL exists to prevent
+type numericRank int
+
+const (
+	integerRank numericRank = iota
+	decimalRank
+	rationalRank
+	floatingRank
+)
+
+func rankOf(obj Object) numericRank {
+	switch obj.(type) {
+	case DECIMAL:
+		return decimalRank
+	case RATIONAL:
+		return rationalRank
+	case FLOAT:
+		return floatingRank
+	default:
+		return integerRank
+	}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func toDecimal(obj Object) DECIMAL {
+	if d, ok := obj.(DECIMAL); ok {
+		return d
+	}
+	return DECIMAL{toBigInt(obj), 0}
+}
+
+func toRat(obj Object) *big.Rat {
+	switch t := obj.(type) {
+	case INT, BIGINT:
+		return new(big.Rat).SetInt(toBigInt(t))
+	case DECIMAL:
+		return t.ToRat()
+	case RATIONAL:
+		return t.Value
+	case FLOAT:
+		if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
+			return nil
+		}
+		return new(big.Rat).SetFloat64(float64(t))
+	default:
+		return nil
+	}
+}
+
+// parses "12.50" into DECIMAL{1250, 2}
+func ParseDecimal(literal string) (DECIMAL, error) {
+	scale := 0
+	if point := strings.IndexRune(literal, '.'); point >= 0 {
+		scale = len(literal) - point - 1
+		literal = literal[:point] + literal[point+1:]
+	}
+	unscaled, ok := new(big.Int).SetString(literal, 10)
+	if !ok {
+		return DECIMAL{}, errors.New(fmt.Sprintf("invalid DECIMAL literal %s", literal))
+	}
+	return DECIMAL{unscaled, scale}, nil
+}
+
+func toBigInt(obj Object) *big.Int {
+	switch t := obj.(type) {
+	case INT:
+		return big.NewInt(int64(t))
+	case BIGINT:
+		return t.Value
+	default:
+		return nil
+	}
+}
+
+func toFloat(obj Object) float64 {
+	val, _ := obj.ToFloating()
+	return float64(val)
+}
+
+func ApplyArithmeticOperator(operator string, left, right Object) (Object, error) {
+	if !IsNumber(left) || !IsNumber(right) {
+		return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"%s\" operator for %s and %s",
+			operator, Typeof(left), Typeof(right))
+	}
+	lrank, rrank := rankOf(left), rankOf(right)
+	if (lrank == decimalRank && rrank == floatingRank) ||
+		(lrank == floatingRank && rrank == decimalRank) {
+		return nil, RuntimeError(TYPE_ERROR_CODE,
+			"cannot apply \"%s\" operator for %s and %s: convert one operand explicitly",
+			operator, Typeof(left), Typeof(right))
+	}
+	rank := lrank
+	if rrank > rank {
+		rank = rrank
+	}
+
+	switch rank {
+	case integerRank:
+		l, lok := left.(INT)
+		r, rok := right.(INT)
+		if lok && rok {
+			if result, ok := applySmallIntegerOperator(operator, l, r); ok {
+				return result, nil
+			}
+		}
+		return applyBigIntegerOperator(operator, toBigInt(left), toBigInt(right))
+	case decimalRank:
+		return applyDecimalOperator(operator, toDecimal(left), toDecimal(right))
+	case rationalRank:
+		return applyRationalOperator(operator, toRat(left), toRat(right))
+	default:
+		return applyFloatingOperator(operator, toFloat(left), toFloat(right))
+	}
+}
+
+// returns false if the result overflows INT
+func applySmallIntegerOperator(operator string, left, right INT) (Object, bool) {
+	switch operator {
+	case "+":
+		result := left + right
+		if (result > left) == (right > 0) {
+			return result, true
+		}
+	case "-":
+		result := left - right
+		if (result < left) == (right > 0) {
+			return result, true
+		}
+	case "*":
+		if left == 0 || right == 0 {
+			return INT(0), true
+		}
+		result := left * right
+		if result/right == left && !(left == -1 && right == minInt) &&
+			!(right == -1 && left == minInt) {
+			return result, true
+		}
+	case "/":
+		if right != 0 && !(left == minInt && right == -1) {
+			return left / right, true
+		}
+	case "%":
+		if right != 0 && right != -1 {
+			return left % right, true
+		}
+		if right == -1 {
+			return INT(0), true
+		}
+	}
+	return nil, false
+}
+
+func applyBigIntegerOperator(operator string, left, right *big.Int) (Object, error) {
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/":
+		if right.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		result.Quo(left, right)
+	case "%":
+		if right.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		result.Rem(left, right)
+	default:
+		return nil, UNKNOWN_ERROR
+	}
+	return NormalizeInteger(result), nil
+}
+
+// the result has the larger scale of both operands,
+// inexact products and quotients are rounded half to even
+func applyDecimalOperator(operator string, left, right DECIMAL) (Object, error) {
+	scale := left.Scale
+	if right.Scale > scale {
+		scale = right.Scale
+	}
+	l := new(big.Int).Mul(left.Unscaled, pow10(scale-left.Scale))
+	r := new(big.Int).Mul(right.Unscaled, pow10(scale-right.Scale))
+
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(l, r)
+	case "-":
+		result.Sub(l, r)
+	case "*":
+		result = roundHalfEven(new(big.Int).Mul(l, r), pow10(scale))
+	case "/":
+		if r.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		result = roundHalfEven(new(big.Int).Mul(l, pow10(scale)), r)
+	case "%":
+		if r.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		result.Rem(l, r)
+	default:
+		return nil, UNKNOWN_ERROR
+	}
+	return DECIMAL{result, scale}, nil
+}
+
+func roundHalfEven(numerator, denominator *big.Int) *big.Int {
+	quo, rem := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+	if rem.Sign() == 0 {
+		return quo
+	}
+	// compare 2*|rem| with |denominator|
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	cmp := twice.Cmp(new(big.Int).Abs(denominator))
+	if cmp > 0 || (cmp == 0 && quo.Bit(0) == 1) {
+		if numerator.Sign()*denominator.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return quo
+}
+
+func applyRationalOperator(operator string, left, right *big.Rat) (Object, error) {
+	result := new(big.Rat)
+	switch operator {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/":
+		if right.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		result.Quo(left, right)
+	case "%":
+		if right.Sign() == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		// left - right * trunc(left / right)
+		quo := new(big.Rat).Quo(left, right)
+		trunc := new(big.Int).Quo(quo.Num(), quo.Denom())
+		result.Sub(left, new(big.Rat).Mul(right, new(big.Rat).SetInt(trunc)))
+	default:
+		return nil, UNKNOWN_ERROR
+	}
+	return RATIONAL{result}, nil
+}
+
+func applyFloatingOperator(operator string, left, right float64) (Object, error) {
+	switch operator {
+	case "+":
+		return FLOAT(left + right), nil
+	case "-":
+		return FLOAT(left - right), nil
+	case "*":
+		return FLOAT(left * right), nil
+	case "/":
+		if right == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		return FLOAT(left / right), nil
+	case "%":
+		if right == 0 {
+			return nil, DIVISION_BY_ZERO_ERROR
+		}
+		return FLOAT(math.Mod(left, right)), nil
+	default:
+		return nil, UNKNOWN_ERROR
+	}
+}
+
+// returns -1, 0 or 1; ok is false when the numbers are unordered (NaN)
+func CompareNumbers(left, right Object) (int, bool) {
+	if IsInteger(left) && IsInteger(right) {
+		l, lok := left.(INT)
+		r, rok := right.(INT)
+		if lok && rok {
+			switch {
+			case l < r:
+				return -1, true
+			case l > r:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+		return toBigInt(left).Cmp(toBigInt(right)), true
+	}
+	l, r := left, right
+	if lf, ok := l.(FLOAT); ok && math.IsInf(float64(lf), 0) {
+		return compareInfinity(float64(lf), r)
+	}
+	if rf, ok := r.(FLOAT); ok && math.IsInf(float64(rf), 0) {
+		cmp, ok := compareInfinity(float64(rf), l)
+		return -cmp, ok
+	}
+	lrat, rrat := toRat(l), toRat(r)
+	if lrat == nil || rrat == nil {
+		return 0, false
+	}
+	return lrat.Cmp(rrat), true
+}
+
+func compareInfinity(inf float64, other Object) (int, bool) {
+	if f, ok := other.(FLOAT); ok {
+		if math.IsNaN(float64(f)) {
+			return 0, false
+		}
+		if float64(f) == inf {
+			return 0, true
+		}
+	}
+	if inf > 0 {
+		return 1, true
+	}
+	return -1, true
+}
+
+func NegateNumber(obj Object) (Object, error) {
+	switch t := obj.(type) {
+	case INT:
+		if t == minInt {
+			return NormalizeInteger(new(big.Int).Neg(toBigInt(t))), nil
+		}
+		return -t, nil
+	case BIGINT:
+		return NormalizeInteger(new(big.Int).Neg(t.Value)), nil
+	case DECIMAL:
+		return DECIMAL{new(big.Int).Neg(t.Unscaled), t.Scale}, nil
+	case RATIONAL:
+		return RATIONAL{new(big.Rat).Neg(t.Value)}, nil
+	case FLOAT:
+		return -t, nil
+	default:
+		return nil, RuntimeError(TYPE_ERROR_CODE, "cannot apply \"-\" operator for %s",
+			Typeof(obj))
+	}
+}
+
+// converts to INT or BIGINT, truncating towards zero
+func ToIntegerObject(obj Object) (Object, error) {
+	switch t := obj.(type) {
+	case INT, BIGINT:
+		return t, nil
+	case DECIMAL:
+		return NormalizeInteger(new(big.Int).Quo(t.Unscaled, pow10(t.Scale))), nil
+	case RATIONAL:
+		return NormalizeInteger(new(big.Int).Quo(t.Value.Num(), t.Value.Denom())), nil
+	case FLOAT:
+		if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
+			return nil, errors.New(fmt.Sprintf("cannot convert FLOAT %s to INT", t.ToString()))
+		}
+		val, _ := big.NewFloat(float64(t)).Int(nil)
+		return NormalizeInteger(val), nil
+	case STRING:
+		val, ok := ParseIntegerLiteral(strings.TrimSpace(string(t)))
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("cannot convert STRING %s to INT", t))
+		}
+		return NormalizeInteger(val), nil
+	default:
+		val, err := obj.ToInteger()
+		if err != nil {
+			return nil, err
+		}
+		return val, nil
+	}
+}
@@ -0,0 +1,72 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIntegerPromotion(t *testing.T) {
+	tests := []struct {
+		source string
+		output string
+	}{
+		{"say 9223372036854775807 + 1", "9223372036854775808"},
+		{"say type(9223372036854775807 + 1)", "BIGINT"},
+		{"say type(9223372036854775807 + 1 - 1)", "INTEGER"},
+		{"say 3037000500 * 3037000500", "9223372037000250000"},
+		{"say -9223372036854775807 - 1 - 1", "-9223372036854775809"},
+		{"say -(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"say 9223372036854775808 / 2", "4611686018427387904"},
+		{"say type(9223372036854775808 / 2)", "INTEGER"},
+		{"say 9223372036854775808 % 10", "8"},
+		{"say 9223372036854775807 * 2 == 18446744073709551614", "true"},
+		{"say 7 / 2", "3"},
+		{"say 1 + 0.5", "1.500000"},
+		{"say 0.1d + 0.2d", "0.3"},
+		{"say 1/3r + 1/6r", "1/2"},
+	}
+	for _, test := range tests {
+		output, err := runScript(t, test.source)
+		if err != nil {
+			t.Errorf("%s: %s", test.source, err)
+			continue
+		}
+		if got := strings.TrimSpace(output); got != test.output {
+			t.Errorf("%s: got %s, want %s", test.source, got, test.output)
+		}
+	}
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	tests := []struct {
+		source string
+		output string
+	}{
+		{"let x = 5\nx += 2\nsay x", "7"},
+		{"let x = 5\nx -= 7\nsay x", "-2"},
+		{"let x = 5\nx *= 3\nsay x", "15"},
+		{"let x = 7\nx /= 2\nsay x", "3"},
+		{"let x = 7\nx %= 4\nsay x", "3"},
+		{"let x = 9223372036854775807\nx += 1\nsay x", "9223372036854775808"},
+	}
+	for _, test := range tests {
+		output, err := runScript(t, test.source)
+		if err != nil {
+			t.Errorf("%q: %s", test.source, err)
+			continue
+		}
+		if got := strings.TrimSpace(output); got != test.output {
+			t.Errorf("%q: got %s, want %s", test.source, got, test.output)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	for _, source := range []string{"say 1 / 0", "say 9223372036854775808 % 0", "say 1d / 0d"} {
+		_, err := runScript(t, source)
+		if !errors.Is(err, DIVISION_BY_ZERO_ERROR) {
+			t.Errorf("%s: got %v, want division by zero", source, err)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package core
 import (
 	"errors"
 	"fmt"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -17,6 +19,11 @@ const (
 	NULL_TYPE
 	ARRAY_TYPE
 	FUNCTION_TYPE
+	BIGINT_TYPE
+	DECIMAL_TYPE
+	RATIONAL_TYPE
+	BUILTIN_TYPE
+	MAP_TYPE
 )
 
 func Typeof(obj Object) string {
@@ -39,6 +46,16 @@ func (s ObjectType) FormatObjectType() string {
 		return "ARRAY"
 	case FUNCTION_TYPE:
 		return "FUNCTION"
+	case BIGINT_TYPE:
+		return "BIGINT"
+	case DECIMAL_TYPE:
+		return "DECIMAL"
+	case RATIONAL_TYPE:
+		return "RATIONAL"
+	case BUILTIN_TYPE:
+		return "BUILTIN"
+	case MAP_TYPE:
+		return "MAP"
 	default:
 		return "UNKNOWN"
 	}
@@ -53,6 +70,12 @@ type Object interface {
 	ToBoolean() (BOOL, error)
 }
 
+// objects that can be called from scripts: FUNCTION and BUILTIN
+type CALLABLE interface {
+	Object
+	Call(interpreter *Interpreter, args []Object) (Object, error)
+}
+
 // primitives
 type BOOL bool
 
@@ -101,6 +124,92 @@ func (s INT) ToFloating() (FLOAT, error) {
 	return FLOAT(s), nil
 }
 
+// BIGINT holds integers that do not fit into INT. Arithmetic never
+// produces a BIGINT whose value fits into INT, see NormalizeInteger
+type BIGINT struct {
+	Value *big.Int
+}
+
+func (s BIGINT) Typeof() ObjectType {
+	return BIGINT_TYPE
+}
+func (s BIGINT) ToString() string {
+	return s.Value.String()
+}
+func (s BIGINT) ToBoolean() (BOOL, error) {
+	return BOOL(s.Value.Sign() != 0), nil
+}
+func (s BIGINT) ToInteger() (INT, error) {
+	if !fitsInt(s.Value) {
+		return 0, errors.New(fmt.Sprintf("BIGINT %s is too large for INT", s.Value))
+	}
+	return INT(s.Value.Int64()), nil
+}
+func (s BIGINT) ToFloating() (FLOAT, error) {
+	val, _ := new(big.Float).SetInt(s.Value).Float64()
+	return FLOAT(val), nil
+}
+
+// DECIMAL is an exact decimal number Unscaled * 10^-Scale,
+// the scale is kept fixed by arithmetic, see applyDecimalOperator
+type DECIMAL struct {
+	Unscaled *big.Int
+	Scale    int
+}
+
+func (s DECIMAL) Typeof() ObjectType {
+	return DECIMAL_TYPE
+}
+func (s DECIMAL) ToString() string {
+	digits := new(big.Int).Abs(s.Unscaled).String()
+	sign := ""
+	if s.Unscaled.Sign() < 0 {
+		sign = "-"
+	}
+	if s.Scale == 0 {
+		return sign + digits
+	}
+	if len(digits) <= s.Scale {
+		digits = strings.Repeat("0", s.Scale-len(digits)+1) + digits
+	}
+	point := len(digits) - s.Scale
+	return sign + digits[:point] + "." + digits[point:]
+}
+func (s DECIMAL) ToBoolean() (BOOL, error) {
+	return BOOL(s.Unscaled.Sign() != 0), nil
+}
+func (s DECIMAL) ToInteger() (INT, error) {
+	return BIGINT{new(big.Int).Quo(s.Unscaled, pow10(s.Scale))}.ToInteger()
+}
+func (s DECIMAL) ToFloating() (FLOAT, error) {
+	return RATIONAL{s.ToRat()}.ToFloating()
+}
+func (s DECIMAL) ToRat() *big.Rat {
+	return new(big.Rat).SetFrac(s.Unscaled, pow10(s.Scale))
+}
+
+// RATIONAL is an exact fraction, always kept in lowest terms by math/big
+type RATIONAL struct {
+	Value *big.Rat
+}
+
+func (s RATIONAL) Typeof() ObjectType {
+	return RATIONAL_TYPE
+}
+func (s RATIONAL) ToString() string {
+	return s.Value.RatString()
+}
+func (s RATIONAL) ToBoolean() (BOOL, error) {
+	return BOOL(s.Value.Sign() != 0), nil
+}
+func (s RATIONAL) ToInteger() (INT, error) {
+	return BIGINT{new(big.Int).Quo(s.Value.Num(), s.Value.Denom())}.ToInteger()
+}
+func (s RATIONAL) ToFloating() (FLOAT, error) {
+	val, _ := s.Value.Float64()
+	return FLOAT(val), nil
+}
+
 type FLOAT float64
 
 func (s FLOAT) Typeof() ObjectType {
@@ -185,7 +294,41 @@ func (s ARRAY) ToFloating() (FLOAT, error) {
 	return 0.0, errors.New("invalid conversion: ARRAY to FLOAT")
 }
 
+// MAP has no literal syntax, maps come from the host application,
+// see convert.go
+type MAP map[string]Object
+
+func (s MAP) Typeof() ObjectType {
+	return MAP_TYPE
+}
+func (s MAP) ToString() string {
+	strs := make([]string, 0, len(s))
+	for _, key := range s.Keys() {
+		strs = append(strs, fmt.Sprintf("%s: %s", strconv.Quote(key), s[key].ToString()))
+	}
+	return "{" + strings.Join(strs, ", ") + "}"
+}
+func (s MAP) ToBoolean() (BOOL, error) {
+	return false, errors.New("invalid conversion: MAP to BOOLEAN")
+}
+func (s MAP) ToInteger() (INT, error) {
+	return 0, errors.New("invalid conversion: MAP to INT")
+}
+func (s MAP) ToFloating() (FLOAT, error) {
+	return 0.0, errors.New("invalid conversion: MAP to FLOAT")
+}
+func (s MAP) Keys() []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 type FUNCTION struct {
+	// empty for anonymous functions not bound with LET
+	Name    string
 	Args    []string
 	Body    []STATEMENT_NODE
 	Context *Scope
@@ -206,3 +349,33 @@ func (s FUNCTION) ToInteger() (INT, error) {
 func (s FUNCTION) ToFloating() (FLOAT, error) {
 	return 0.0, errors.New("invalid conversion: FUNCTION to FLOAT")
 }
+func (s FUNCTION) Call(interpreter *Interpreter, args []Object) (Object, error) {
+	return interpreter.CallFunction(s, args)
+}
+
+type BuiltinFunction func(*Interpreter, []Object) (Object, error)
+
+// BUILTIN wraps a native Go function, see builtins.go
+type BUILTIN struct {
+	Name string
+	Fn   BuiltinFunction
+}
+
+func (s BUILTIN) Typeof() ObjectType {
+	return BUILTIN_TYPE
+}
+func (s BUILTIN) ToString() string {
+	return fmt.Sprintf("builtin function %s", s.Name)
+}
+func (s BUILTIN) ToBoolean() (BOOL, error) {
+	return false, errors.New("invalid conversion: BUILTIN to BOOLEAN")
+}
+func (s BUILTIN) ToInteger() (INT, error) {
+	return 0, errors.New("invalid conversion: BUILTIN to INT")
+}
+func (s BUILTIN) ToFloating() (FLOAT, error) {
+	return 0.0, errors.New("invalid conversion: BUILTIN to FLOAT")
+}
+func (s BUILTIN) Call(interpreter *Interpreter, args []Object) (Object, error) {
+	return s.Fn(interpreter, args)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestBinaryOperators(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right Object
+		result      string
+	}{
+		{"+", STRING("ab"), STRING("cd"), "abcd"},
+		{"+", STRING(""), STRING(""), ""},
+		{"+", ARRAY{INT(1)}, ARRAY{INT(2), STRING("x")}, "[1, 2, x]"},
+		{"+", ARRAY{}, ARRAY{}, "[]"},
+		{"==", STRING("a"), STRING("a"), "true"},
+		{"==", STRING("a"), STRING("b"), "false"},
+		{"!=", STRING("a"), STRING("b"), "true"},
+		{"==", BOOL(true), BOOL(true), "true"},
+		{"==", NULL{}, NULL{}, "true"},
+		{"==", ARRAY{INT(1), ARRAY{FLOAT(2)}}, ARRAY{INT(1), ARRAY{INT(2)}}, "true"},
+		{"==", ARRAY{INT(1)}, ARRAY{INT(1), INT(2)}, "false"},
+		// values of different types are never equal
+		{"==", STRING("1"), INT(1), "false"},
+		{"!=", NULL{}, BOOL(false), "true"},
+		{"<", STRING("abc"), STRING("abd"), "true"},
+		{">", STRING("b"), STRING("abc"), "true"},
+		{"<=", STRING("a"), STRING("a"), "true"},
+		{">=", STRING(""), STRING("a"), "false"},
+		{"&", BOOL(true), BOOL(false), "false"},
+		{"&", BOOL(true), BOOL(true), "true"},
+		{"|", BOOL(false), BOOL(true), "true"},
+		{"|", BOOL(false), BOOL(false), "false"},
+	}
+	for _, test := range tests {
+		result, err := ApplyBinaryOperator(test.operator, test.left, test.right)
+		if err != nil {
+			t.Errorf("%s %s %s failed: %s", test.left.ToString(), test.operator, test.right.ToString(), err)
+			continue
+		}
+		if result.ToString() != test.result {
+			t.Errorf("%s %s %s = %s, want %s",
+				test.left.ToString(), test.operator, test.right.ToString(), result.ToString(), test.result)
+		}
+	}
+}
+
+func TestBinaryOperatorTypeErrors(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right Object
+	}{
+		{"+", STRING("a"), INT(1)},
+		{"+", ARRAY{}, STRING("a")},
+		{"<", STRING("a"), INT(1)},
+		{"<", ARRAY{}, ARRAY{}},
+		{">=", BOOL(true), BOOL(false)},
+		{"&", BOOL(true), INT(1)},
+		{"|", NULL{}, BOOL(true)},
+	}
+	for _, test := range tests {
+		if result, err := ApplyBinaryOperator(test.operator, test.left, test.right); err == nil {
+			t.Errorf("%s %s %s = %s, want an error",
+				test.left.ToString(), test.operator, test.right.ToString(), result.ToString())
+		}
+	}
+}
@@ -1,13 +1,25 @@
 package core
 
 import (
-	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
-func Chain(err1, err2 error) error {
-	return fmt.Errorf("%s,\n%s", err1, err2)
+// adds context to err. A ScriptError context becomes a note of the error
+// and gives it the position of the context if it has none yet
+func Chain(context, err error) error {
+	ctx, ok := context.(*ScriptError)
+	if !ok {
+		return fmt.Errorf("%s,\n%w", context, err)
+	}
+	scriptErr := ToScriptError(ctx.Kind, err)
+	if !scriptErr.HasPosition() {
+		scriptErr.Start, scriptErr.End = ctx.Start, ctx.End
+	}
+	scriptErr.Notes = append(scriptErr.Notes, fmt.Sprintf("%s %s", ctx.Message, ctx.Start.Format()))
+	return scriptErr
 }
 
 func Includes(operators []string, operator string) bool {
@@ -22,6 +34,11 @@ func Includes(operators []string, operator string) bool {
 type Parser struct {
 	stream *Lexer
 	pos    Position
+	file   string
+	// number of open "(" and "[", newlines inside them never end a statement
+	depth int
+	// syntax errors found so far, see Recover
+	errors ErrorList
 }
 
 func NewParser(code string) *Parser {
@@ -36,139 +53,290 @@ func (self *Parser) SetPosition() {
 	self.pos = Position{current.Line, current.Column}
 }
 
+// a newline ends a statement, unless it is inside brackets
+func (self *Parser) AtLineBreak() bool {
+	return self.depth == 0 && self.stream.Peek().NewlineBefore
+}
+
+// statements are separated by ";" or by a newline
+func (self *Parser) NextIfStatementEnd() bool {
+	return self.stream.NextIf(";") || self.AtLineBreak()
+}
+
+// name of the parsed file, used in error messages
+func (self *Parser) SetFile(file string) {
+	self.file = file
+}
+
+// position of the next token
+func (self *Parser) Start() Position {
+	token := self.stream.Peek()
+	return Position{token.Line, token.Column}
+}
+
+// span from start to the end of the last consumed token
+func (self *Parser) SpanFrom(start Position) Span {
+	end := start
+	if token := self.stream.Previous(); token != nil {
+		end = Position{token.EndLine, token.EndColumn}
+	}
+	return Span{start, end}
+}
+
+// a context for Chain at the current position
 func (self *Parser) Err(info string) error {
-	return errors.New(fmt.Sprintf("%s: %s", info, self.pos.Format()))
+	return ErrorContext(PARSE_ERROR, info, self.pos, self.pos)
+}
+
+// an error pointing at token, an ILLEGAL_TOKEN reports why the lexer
+// rejected it instead of the message
+func (self *Parser) TokenErr(token *Token, format string, args ...interface{}) *ScriptError {
+	var err *ScriptError
+	switch token.Type {
+	case ILLEGAL_TOKEN:
+		err = NewScriptError(LEX_ERROR, token.ErrorCode, "%s", token.Error)
+	case EOF_TOKEN:
+		err = NewScriptError(PARSE_ERROR, UNEXPECTED_EOF_CODE, format, args...)
+	default:
+		err = NewScriptError(PARSE_ERROR, UNEXPECTED_TOKEN_CODE, format, args...)
+	}
+	err.File = self.file
+	err.Start = Position{token.Line, token.Column}
+	err.End = Position{token.EndLine, token.EndColumn}
+	return err
+}
+
+// a literal token the lexer accepted but that does not convert to typeName
+func (self *Parser) LiteralErr(token *Token, typeName string) error {
+	err := self.TokenErr(token, "failed to parse %s to %s", token.Describe(), typeName)
+	err.Code = INVALID_LITERAL_CODE
+	return err
 }
 
 // main functions
+
+// ParseProgram parses the whole input. It does not stop at the first
+// syntax error: failed statements become ERROR_STATEMENTs and parsing goes
+// on after them, the error is an ErrorList of everything found
 func (self *Parser) ParseProgram() ([]STATEMENT_NODE, error) {
-	if self.stream.Eof() {
-		return []STATEMENT_NODE{}, nil
-	}
-	statement, err := self.ParseStatement()
-	if err != nil {
-		return nil, err
+	self.errors = nil
+	program := self.ParseStatements(false)
+	if len(self.errors) > 0 {
+		return program, self.errors
 	}
+	return program, nil
+}
 
-	if self.stream.NextIf(";") {
-		nextStatements, err := self.ParseProgram()
+// comments of the parsed source, in source order
+func (self *Parser) Comments() []Comment {
+	return self.stream.Comments()
+}
+
+// syntax errors of the last ParseProgram, in source order
+func (self *Parser) Errors() ErrorList {
+	return self.errors
+}
+
+// parses statements up to the end of input or, in a block, up to
+// the closing "}" which is consumed
+func (self *Parser) ParseStatements(block bool) []STATEMENT_NODE {
+	statements := []STATEMENT_NODE{}
+	for {
+		if block && self.stream.NextIf("}") {
+			return statements
+		}
+		if self.stream.Eof() {
+			if block {
+				self.errors = append(self.errors, self.TokenErr(self.stream.Peek(),
+					"closing \"}\" expected, found end of input"))
+			}
+			return statements
+		}
+
+		first := self.stream.Peek()
+		statement, err := self.ParseStatement()
 		if err != nil {
-			return nil, err
+			statements = append(statements, self.Recover(err, first, block))
+			continue
+		}
+		statements = append(statements, statement)
+
+		if self.NextIfStatementEnd() || self.stream.Eof() ||
+			(block && self.stream.Peek().Symbol() == "}") {
+			continue
+		}
+		next_tok := self.stream.Peek()
+		expected := "EOF, newline or \";\""
+		if block {
+			expected = "closing \"}\", newline or \";\""
+		}
+		err = self.TokenErr(next_tok, "%s expected, found %s", expected, next_tok.Describe())
+		statements = append(statements, self.Recover(err, nil, block))
+	}
+}
+
+// statement keywords parsing can resynchronize at
+var SYNC_KEYWORDS = []string{"let", "for", "if", "say", "return", "break", "continue"}
+
+// records err and skips to where the next statement probably starts:
+// after a ";" or a balanced "{ }" block, or before a statement keyword,
+// a line break or the "}" closing the block. first is the first token of
+// the failed statement, it is always skipped so parsing moves on
+func (self *Parser) Recover(err error, first *Token, block bool) STATEMENT_NODE {
+	scriptErr := ToScriptError(PARSE_ERROR, err)
+	if scriptErr.File == "" {
+		scriptErr.File = self.file
+	}
+	settle(scriptErr)
+	self.errors = append(self.errors, scriptErr)
+	node := &ERROR_STATEMENT{Err: scriptErr, Position: scriptErr.Start, End: scriptErr.End}
+
+	// the token the statement failed at may start the next one,
+	// Backup fails if it was not consumed
+	last := self.stream.Previous()
+	if last == nil || last == first || !self.IsSyncPoint(last) || !self.stream.Backup() {
+		if self.stream.Peek() == first {
+			self.stream.Next()
+		}
+	}
+	self.depth = 0
+	for !self.stream.Eof() {
+		token := self.stream.Peek()
+		switch {
+		case token.Symbol() == ";":
+			self.stream.Next()
+			return node
+		case token.Symbol() == "}":
+			if !block {
+				// a stray "}" at the top level
+				self.stream.Next()
+			}
+			return node
+		case token.Symbol() == "{":
+			self.SkipBlock()
+			return node
+		case self.IsSyncPoint(token):
+			return node
 		}
-		return append([]STATEMENT_NODE{statement}, nextStatements...), nil
+		self.stream.Next()
 	}
-	if self.stream.Peek().Type != EOF_TOKEN {
-		return nil, errors.New(fmt.Sprintf("EOF or \";\" expected, found %s",
-			self.stream.Next().Format()))
+	return node
+}
+
+func (self *Parser) IsSyncPoint(token *Token) bool {
+	return token.NewlineBefore || Includes(SYNC_KEYWORDS, token.Symbol()) ||
+		Includes([]string{";", "{", "}"}, token.Symbol())
+}
+
+// skips a "{ }" block with everything nested in it
+func (self *Parser) SkipBlock() {
+	depth := 0
+	for !self.stream.Eof() {
+		switch self.stream.Next().Symbol() {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
 	}
-	return []STATEMENT_NODE{statement}, nil
 }
 
 func (self *Parser) ParseStatement() (STATEMENT_NODE, error) {
 	self.SetPosition()
+	// nested statements move self.pos, keep where this one starts
+	start := self.pos
+	Err := func(info string) error {
+		err := ErrorContext(PARSE_ERROR, info, start, start)
+		err.File = self.file
+		return err
+	}
 	var node STATEMENT_NODE
 
 	if self.stream.NextIf("break") {
-		node = &BREAK_STATEMENT{self.pos}
+		node = &BREAK_STATEMENT{Position: start}
 	} else if self.stream.NextIf("continue") {
-		node = &CONTINUE_STATEMENT{self.pos}
+		node = &CONTINUE_STATEMENT{Position: start}
 	} else if self.stream.NextIf("return") {
 		expression, err := self.ParseExpression()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing RETURN statement expression"), err)
+			return nil, Chain(Err("while parsing RETURN statement expression"), err)
 		}
-		node = &RETURN_STATEMENT{expression, self.pos}
-	} else if self.stream.NextIf("let") {
+		node = &RETURN_STATEMENT{Expression: expression, Position: start}
+	} else if doc := self.stream.Peek().Doc; self.stream.NextIf("let") {
 		identifier := self.stream.Next()
 		if identifier.Type != ID_TOKEN {
-			return nil, self.Err(fmt.Sprintf(
-				"while parsing LET statement: expected IDENTIFIER, found %s",
-				identifier.Format()))
+			return nil, Chain(Err("while parsing LET statement"),
+				self.TokenErr(identifier, "expected IDENTIFIER, found %s", identifier.Describe()))
 		}
 		var initial EXPRESSION_NODE
 		if self.stream.NextIf("=") {
 			expression, err := self.ParseExpression()
 			if err != nil {
-				return nil, Chain(self.Err("while parsing LET statement"), err)
+				return nil, Chain(Err("while parsing LET statement"), err)
 			}
 			initial = expression
 		}
-		node = &LET_STATEMENT{identifier.Literal, initial, self.pos}
+		node = &LET_STATEMENT{Identifier: identifier.Literal, Name: identifier.Span(), Expression: initial, Doc: doc, Position: start}
 	} else if self.stream.NextIf("for") {
 		expression, err := self.ParseExpression()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing FOR statement condition"), err)
+			return nil, Chain(Err("while parsing FOR statement condition"), err)
 		}
 		body, err := self.ParseStatementList()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing FOR statement body"), err)
+			return nil, Chain(Err("while parsing FOR statement body"), err)
 		}
-		node = &FOR_STATEMENT{expression, body, self.pos}
+		node = &FOR_STATEMENT{Condition: expression, Body: body, Position: start}
 	} else if self.stream.NextIf("if") {
 		condition, err := self.ParseExpression()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing IF statement condition"), err)
+			return nil, Chain(Err("while parsing IF statement condition"), err)
 		}
 		then, err := self.ParseStatementList()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing IF statement THEN brahcn"), err)
+			return nil, Chain(Err("while parsing IF statement THEN branch"), err)
 		}
+		thenEnd := self.SpanFrom(start).End
 		var els []STATEMENT_NODE
 		if self.stream.NextIf("else") {
 			statements, err := self.ParseStatementList()
 			if err != nil {
-				return nil, Chain(self.Err("while parsing IF statement ELSE branch"), err)
+				return nil, Chain(Err("while parsing IF statement ELSE branch"), err)
 			}
 			els = statements
 		}
-		node = &IF_STATEMENT{condition, then, els, self.pos}
+		node = &IF_STATEMENT{Condition: condition, Then: then, Els: els, Position: start, ThenEnd: thenEnd}
 	} else if self.stream.NextIf("say") {
 		expression, err := self.ParseExpression()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing SAY statement"), err)
+			return nil, Chain(Err("while parsing SAY statement"), err)
 		}
-		node = &SAY_STATEMENT{expression, self.pos}
+		node = &SAY_STATEMENT{Expression: expression, Position: start}
 	} else {
 		expression, err := self.ParseExpression()
 		if err != nil {
-			return nil, Chain(self.Err("while parsing EXPRESSION statement"), err)
+			return nil, Chain(Err("while parsing EXPRESSION statement"), err)
 		}
-		node = &EXPRESSION_STATEMENT{expression, self.pos}
+		node = &EXPRESSION_STATEMENT{Expression: expression, Position: start}
 	}
 
+	node.setEnd(self.SpanFrom(start).End)
 	return node, nil
 }
 
 func (self *Parser) ParseStatementList() ([]STATEMENT_NODE, error) {
 	next_token := self.stream.Next()
-	if next_token.Literal != "{" {
-		return nil, errors.New(fmt.Sprintf("expected \"{\" while parsing statement list, found %s",
-			next_token.Format()))
+	if next_token.Symbol() != "{" {
+		return nil, self.TokenErr(next_token, "expected \"{\" while parsing statement list, found %s", next_token.Describe())
 	}
 
-	return self.ParseStatementList_()
-}
-
-func (self *Parser) ParseStatementList_() ([]STATEMENT_NODE, error) {
-	if self.stream.NextIf("}") {
-		return []STATEMENT_NODE{}, nil
-	}
-	statement, err := self.ParseStatement()
-	if err != nil {
-		return nil, err
-	}
-	if self.stream.NextIf(";") {
-		next_statements, err := self.ParseStatementList_()
-		if err != nil {
-			return nil, err
-		}
-		return append([]STATEMENT_NODE{statement}, next_statements...), nil
-	}
-	next_tok := self.stream.Next()
-	if next_tok.Literal != "}" {
-		return nil, errors.New(fmt.Sprintf("closing \"}\" or \";\" expected, found %s", next_tok.Format()))
-	}
-	return []STATEMENT_NODE{statement}, nil
+	depth := self.depth
+	self.depth = 0
+	defer func() { self.depth = depth }()
+	return self.ParseStatements(true), nil
 }
 
 // hope nobody will see it
@@ -215,21 +383,23 @@ func (self *Parser) ParseBinaryAssignExpression(
 	operators []string,
 	parser func() (EXPRESSION_NODE, error),
 ) (EXPRESSION_NODE, error) {
+	start := self.Start()
 	left, err := parser()
 	if err != nil {
 		return nil, err
 	}
-	for Includes(operators, self.stream.Peek().Literal) {
+	for Includes(operators, self.stream.Peek().Symbol()) {
 		id, ok := left.(*VARIABLE_EXPRESSION)
 		if !ok {
-			return nil, errors.New("expected identifier in ASSIGN expression")
+			return nil, self.TokenErr(self.stream.Peek(),
+				"expected identifier on the left of %s", self.stream.Peek().Describe())
 		}
 		operator := self.stream.Next().Literal
 		right, err := self.ParseBinaryAssignExpression(operators, parser)
 		if err != nil {
 			return nil, err
 		}
-		left = &BINARY_ASSIGN_EXPRESSION{operator, id.Identifier, right}
+		left = &BINARY_ASSIGN_EXPRESSION{operator, id.Identifier, id.Span, right, self.SpanFrom(start)}
 	}
 	return left, nil
 }
@@ -242,13 +412,18 @@ func (self *Parser) ParseBinaryExpression(
 	if err != nil {
 		return nil, err
 	}
-	for Includes(operators, self.stream.Peek().Literal) {
+	for Includes(operators, self.stream.Peek().Symbol()) {
+		// "+" and "-" at the start of a line begin a new statement,
+		// other binary operators continue the previous line
+		if self.AtLineBreak() && Includes([]string{"+", "-"}, self.stream.Peek().Symbol()) {
+			break
+		}
 		operator := self.stream.Next().Literal
 		right, err := parser()
 		if err != nil {
 			return nil, err
 		}
-		left = &BINARY_EXPRESSION{operator, left, right}
+		left = &BINARY_EXPRESSION{operator, left, right, Span{left.GetSpan().Start, right.GetSpan().End}}
 	}
 	return left, nil
 }
@@ -258,13 +433,14 @@ func (self *Parser) ParsePrimaryExpression() (EXPRESSION_NODE, error) {
 }
 
 func (self *Parser) ParseUnaryOperatorExpression() (EXPRESSION_NODE, error) {
-	if Includes([]string{"!", "-", "+"}, self.stream.Peek().Literal) {
+	start := self.Start()
+	if Includes([]string{"!", "-", "+"}, self.stream.Peek().Symbol()) {
 		operator := self.stream.Next().Literal
 		expression, err := self.ParseUnaryOperatorExpression()
 		if err != nil {
 			return nil, err
 		}
-		return &UNARY_OPERATION_EXPRESSION{operator, expression}, nil
+		return &UNARY_OPERATION_EXPRESSION{operator, expression, self.SpanFrom(start)}, nil
 	}
 	expression, err := self.ParseValueExpression()
 	if err != nil {
@@ -276,17 +452,23 @@ func (self *Parser) ParseUnaryOperatorExpression() (EXPRESSION_NODE, error) {
 func (self *Parser) ParsePostExpressionOperator(
 	prev EXPRESSION_NODE,
 ) (EXPRESSION_NODE, error) {
+	// "(" or "[" on a new line starts a new statement
+	if self.AtLineBreak() {
+		return prev, nil
+	}
+
 	if self.stream.NextIf("[") {
+		self.depth++
 		index, err := self.ParseExpression()
+		self.depth--
 		if err != nil {
 			return nil, err
 		}
 		next_tok := self.stream.Next()
-		if next_tok.Literal != "]" {
-			return nil, errors.New(fmt.Sprintf("expected closing \"]\", found %s",
-				next_tok.Format()))
+		if next_tok.Symbol() != "]" {
+			return nil, self.TokenErr(next_tok, "expected closing \"]\", found %s", next_tok.Describe())
 		}
-		expression := &INDEX_OPERATOR_EXPRESSION{prev, index}
+		expression := &INDEX_OPERATOR_EXPRESSION{prev, index, self.SpanFrom(prev.GetSpan().Start)}
 		return self.ParsePostExpressionOperator(expression)
 	}
 
@@ -295,7 +477,7 @@ func (self *Parser) ParsePostExpressionOperator(
 		if err != nil {
 			return nil, err
 		}
-		expression := &FUNCTION_CALL_EXPRESSION{prev, arglist}
+		expression := &FUNCTION_CALL_EXPRESSION{prev, arglist, self.SpanFrom(prev.GetSpan().Start)}
 		return self.ParsePostExpressionOperator(expression)
 	}
 
@@ -303,6 +485,12 @@ func (self *Parser) ParsePostExpressionOperator(
 }
 
 func (self *Parser) ParseExpressionList(end string) ([]EXPRESSION_NODE, error) {
+	self.depth++
+	defer func() { self.depth-- }()
+	return self.ParseExpressionList_(end)
+}
+
+func (self *Parser) ParseExpressionList_(end string) ([]EXPRESSION_NODE, error) {
 	if self.stream.NextIf(end) {
 		return []EXPRESSION_NODE{}, nil
 	}
@@ -312,7 +500,7 @@ func (self *Parser) ParseExpressionList(end string) ([]EXPRESSION_NODE, error) {
 	}
 
 	if self.stream.NextIf(",") {
-		next_expressions, err := self.ParseExpressionList(end)
+		next_expressions, err := self.ParseExpressionList_(end)
 		if err != nil {
 			return nil, err
 		}
@@ -320,49 +508,58 @@ func (self *Parser) ParseExpressionList(end string) ([]EXPRESSION_NODE, error) {
 	}
 
 	next_tok := self.stream.Next()
-	if next_tok.Literal != end {
-		return nil, errors.New(fmt.Sprintf("expected closing \"%s\" or \",\", found %s",
-			end, next_tok.Format()))
+	if next_tok.Symbol() != end {
+		return nil, self.TokenErr(next_tok, "expected closing \"%s\" or \",\", found %s", end, next_tok.Describe())
 	}
 	return []EXPRESSION_NODE{expression}, nil
 }
 
-func (self *Parser) ParseFunctionArgsList(end string) ([]string, error) {
-	if self.stream.Peek().Literal == end {
-		return []string{}, nil
+// parameter names up to end and the spans of the names
+func (self *Parser) ParseFunctionArgsList(end string) ([]string, []Span, error) {
+	if self.stream.Peek().Symbol() == end {
+		return []string{}, []Span{}, nil
 	}
 	next_tok := self.stream.Next()
 	if next_tok.Type != ID_TOKEN {
-		return nil, errors.New(fmt.Sprintf("identifier expected, found %s",
-			next_tok.Format()))
+		return nil, nil, self.TokenErr(next_tok, "identifier expected, found %s", next_tok.Describe())
 	}
-	id := next_tok.Literal
+	id, span := next_tok.Literal, next_tok.Span()
 
 	if self.stream.NextIf(",") {
-		next_ids, err := self.ParseFunctionArgsList(end)
+		next_ids, next_spans, err := self.ParseFunctionArgsList(end)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		return append([]string{id}, next_ids...), nil
+		return append([]string{id}, next_ids...), append([]Span{span}, next_spans...), nil
 	}
 
-	if self.stream.Peek().Literal != end {
-		return nil, errors.New(fmt.Sprintf("expected closing \"%s\" or \",\", found %s",
-			end, self.stream.Peek().Format()))
+	if self.stream.Peek().Symbol() != end {
+		return nil, nil, self.TokenErr(self.stream.Peek(), "expected closing \"%s\" or \",\", found %s", end, self.stream.Peek().Describe())
 	}
-	return []string{id}, nil
+	return []string{id}, []Span{span}, nil
+}
+
+// accepts decimal literals as well as 0x, 0o and 0b prefixed ones,
+// with optional "_" digit separators
+func ParseIntegerLiteral(literal string) (*big.Int, bool) {
+	if len(literal) > 1 && literal[0] == '0' && strings.ContainsRune("xXoObB", rune(literal[1])) {
+		return new(big.Int).SetString(literal, 0)
+	}
+	return new(big.Int).SetString(strings.ReplaceAll(literal, "_", ""), 10)
 }
 
 func (self *Parser) ParseValueExpression() (EXPRESSION_NODE, error) {
+	start := self.Start()
 	if self.stream.NextIf("(") {
+		self.depth++
 		expression, err := self.ParseExpression()
+		self.depth--
 		if err != nil {
 			return nil, err
 		}
 		next_tok := self.stream.Next()
-		if next_tok.Literal != ")" {
-			return nil, errors.New(fmt.Sprintf("expected closing \")\", found %s",
-				next_tok.Format()))
+		if next_tok.Symbol() != ")" {
+			return nil, self.TokenErr(next_tok, "expected closing \")\", found %s", next_tok.Describe())
 		}
 		return expression, nil
 	}
@@ -372,20 +569,21 @@ func (self *Parser) ParseValueExpression() (EXPRESSION_NODE, error) {
 		if err != nil {
 			return nil, err
 		}
-		return &ARRAY_EXPRESSION{exprlist}, nil
+		return &ARRAY_EXPRESSION{exprlist, self.SpanFrom(start)}, nil
 	}
 
+	doc := self.stream.Peek().Doc
 	if self.stream.NextIf("fn") {
-		name := ""
+		name, nameSpan := "", Span{}
 		if self.stream.Peek().Type == ID_TOKEN {
-			name = self.stream.Next().Literal
+			token := self.stream.Next()
+			name, nameSpan = token.Literal, token.Span()
 		}
 		next_tok := self.stream.Next()
-		if next_tok.Literal != ":" {
-			return nil, errors.New(fmt.Sprintf("\":\" expected, found %s",
-				next_tok.Format()))
+		if next_tok.Symbol() != ":" {
+			return nil, self.TokenErr(next_tok, "\":\" expected, found %s", next_tok.Describe())
 		}
-		args, err := self.ParseFunctionArgsList("{")
+		args, params, err := self.ParseFunctionArgsList("{")
 		if err != nil {
 			return nil, err
 		}
@@ -394,15 +592,14 @@ func (self *Parser) ParseValueExpression() (EXPRESSION_NODE, error) {
 			return nil, err
 		}
 
-		return &FUNCTIONAL_EXPRESSION{name, args, body}, nil
+		return &FUNCTIONAL_EXPRESSION{name, nameSpan, args, params, body, doc, false, self.SpanFrom(start)}, nil
 	}
 
 	if self.stream.NextIf("lambda") {
-		args, err := self.ParseFunctionArgsList(":")
+		args, params, err := self.ParseFunctionArgsList(":")
 		next_tok := self.stream.Next()
-		if next_tok.Literal != ":" {
-			return nil, errors.New(fmt.Sprintf("\":\" expected, found %s",
-				next_tok.Format()))
+		if next_tok.Symbol() != ":" {
+			return nil, self.TokenErr(next_tok, "\":\" expected, found %s", next_tok.Describe())
 		}
 		if err != nil {
 			return nil, err
@@ -412,38 +609,59 @@ func (self *Parser) ParseValueExpression() (EXPRESSION_NODE, error) {
 		if err != nil {
 			return nil, err
 		}
-		wrapped_body := []STATEMENT_NODE{&RETURN_STATEMENT{body, self.pos}}
-		return &FUNCTIONAL_EXPRESSION{"", args, wrapped_body}, nil
+		span := self.SpanFrom(start)
+		wrapped_body := []STATEMENT_NODE{&RETURN_STATEMENT{Expression: body, Position: self.pos, End: span.End}}
+		return &FUNCTIONAL_EXPRESSION{"", Span{}, args, params, wrapped_body, doc, true, span}, nil
 	}
 
-	switch next_token := self.stream.Next(); next_token.Type {
+	next_token := self.stream.Next()
+	span := self.SpanFrom(start)
+	switch next_token.Type {
 	case ID_TOKEN:
-		return &VARIABLE_EXPRESSION{next_token.Literal}, nil
+		return &VARIABLE_EXPRESSION{next_token.Literal, span}, nil
 	case INT_TOKEN:
-		val, err := strconv.Atoi(next_token.Literal)
-		if err != nil {
-			return nil, errors.New(fmt.Sprintf("failed to parse %s to INT",
-				next_token.Format()))
+		val, ok := ParseIntegerLiteral(next_token.Literal)
+		if !ok {
+			return nil, self.LiteralErr(next_token, "INT")
+		}
+		if fitsInt(val) {
+			return &PRIMITIVE_LITERAL_EXPRESSION{int(val.Int64()), next_token.Literal, span}, nil
 		}
-		return &PRIMITIVE_LITERAL_EXPRESSION{val}, nil
+		// too large for INT, stored as BIGINT
+		return &PRIMITIVE_LITERAL_EXPRESSION{val, next_token.Literal, span}, nil
 	case FLOAT_TOKEN:
-		val, err := strconv.ParseFloat(next_token.Literal, 64)
+		val, err := strconv.ParseFloat(strings.ReplaceAll(next_token.Literal, "_", ""), 64)
 		if err != nil {
-			return nil, errors.New(fmt.Sprintf("failed to parse %s to FLOAT",
-				next_token.Format()))
+			return nil, self.LiteralErr(next_token, "FLOAT")
+		}
+		return &PRIMITIVE_LITERAL_EXPRESSION{val, next_token.Literal, span}, nil
+	case DECIMAL_TOKEN:
+		literal := strings.ReplaceAll(strings.TrimSuffix(next_token.Literal, "d"), "_", "")
+		val, err := ParseDecimal(literal)
+		if err != nil {
+			return nil, self.LiteralErr(next_token, "DECIMAL")
+		}
+		return &PRIMITIVE_LITERAL_EXPRESSION{val, next_token.Literal, span}, nil
+	case RATIONAL_TOKEN:
+		literal := strings.ReplaceAll(strings.TrimSuffix(next_token.Literal, "r"), "_", "")
+		val, ok := new(big.Rat).SetString(literal)
+		if !ok {
+			return nil, self.LiteralErr(next_token, "RATIONAL")
 		}
-		return &PRIMITIVE_LITERAL_EXPRESSION{val}, nil
+		return &PRIMITIVE_LITERAL_EXPRESSION{val, next_token.Literal, span}, nil
 	case STRING_TOKEN:
-		return &PRIMITIVE_LITERAL_EXPRESSION{next_token.Literal}, nil
+		return &PRIMITIVE_LITERAL_EXPRESSION{next_token.Literal, next_token.Literal, span}, nil
 	case BOOL_TOKEN:
 		if next_token.Literal == "true" {
-			return &PRIMITIVE_LITERAL_EXPRESSION{true}, nil
+			return &PRIMITIVE_LITERAL_EXPRESSION{true, next_token.Literal, span}, nil
 		} else {
-			return &PRIMITIVE_LITERAL_EXPRESSION{false}, nil
+			return &PRIMITIVE_LITERAL_EXPRESSION{false, next_token.Literal, span}, nil
 		}
 	case NULL_TOKEN:
-		return &NULL_EXPRESSION{}, nil
+		return &NULL_EXPRESSION{span}, nil
+	case ILLEGAL_TOKEN:
+		return nil, self.TokenErr(next_token, "illegal token")
 	default:
-		return nil, errors.New(fmt.Sprintf("unexpected %s", next_token.Format()))
+		return nil, self.TokenErr(next_token, "unexpected %s", next_token.Describe())
 	}
 }
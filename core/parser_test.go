@@ -0,0 +1,296 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// the statement types of program, without the package
+func statementKinds(program []STATEMENT_NODE) string {
+	kinds := make([]string, len(program))
+	for i, statement := range program {
+		kinds[i] = strings.TrimPrefix(fmt.Sprintf("%T", statement), "*core.")
+	}
+	return strings.Join(kinds, " ")
+}
+
+func TestParseRecovery(t *testing.T) {
+	tests := []struct {
+		source string
+		// the statements parsed, failed ones are ERROR_STATEMENTs
+		kinds string
+		// line:column code of every error
+		errors []string
+	}{
+		{"let = 1\nsay 2", "ERROR_STATEMENT SAY_STATEMENT", []string{"1:5 E100"}},
+		{"let x = 1 +\nsay x", "ERROR_STATEMENT SAY_STATEMENT", []string{"2:1 E100"}},
+		{"say 1 2\nsay 3", "SAY_STATEMENT ERROR_STATEMENT SAY_STATEMENT", []string{"1:7 E100"}},
+		{"let x = (1; say 2", "ERROR_STATEMENT SAY_STATEMENT", []string{"1:11 E100"}},
+		{"let x = 1 let y = 2", "LET_STATEMENT ERROR_STATEMENT LET_STATEMENT", []string{"1:11 E100"}},
+		{"let = 1; let = 2; say 3", "ERROR_STATEMENT ERROR_STATEMENT SAY_STATEMENT", []string{"1:5 E100", "1:14 E100"}},
+		// a failed statement in a block keeps the block
+		{"if x { let = 1\nsay 2 }\nsay 3", "IF_STATEMENT SAY_STATEMENT", []string{"1:12 E100"}},
+		{"fn f: { say }\nsay 1", "EXPRESSION_STATEMENT SAY_STATEMENT", []string{"1:13 E100"}},
+		// a block after the failure is skipped whole
+		{"for { 1 }\nsay 2", "ERROR_STATEMENT SAY_STATEMENT", []string{"1:5 E100"}},
+		{"}\nsay 1", "ERROR_STATEMENT SAY_STATEMENT", []string{"1:1 E100"}},
+		{"if x {\nsay 1", "IF_STATEMENT", []string{"2:6 E101"}},
+		{"let x = 1\nsay x", "LET_STATEMENT SAY_STATEMENT", nil},
+	}
+	for _, test := range tests {
+		parser := NewParser(test.source)
+		program, err := parser.ParseProgram()
+		if kinds := statementKinds(program); kinds != test.kinds {
+			t.Errorf("%q parsed to %s, want %s", test.source, kinds, test.kinds)
+		}
+		errors := []string{}
+		for _, scriptErr := range parser.Errors() {
+			errors = append(errors, fmt.Sprintf("%d:%d %s", scriptErr.Start.Line, scriptErr.Start.Column, scriptErr.Code))
+		}
+		if strings.Join(errors, ", ") != strings.Join(test.errors, ", ") {
+			t.Errorf("%q has errors %v, want %v", test.source, errors, test.errors)
+		}
+		if (err != nil) != (len(test.errors) > 0) {
+			t.Errorf("%q: ParseProgram returned %v", test.source, err)
+		}
+	}
+}
+
+func TestRecoverSkipsFirstToken(t *testing.T) {
+	// every statement fails at its first token, parsing must still end
+	parser := NewParser(") ) )\n) ;)")
+	program, err := parser.ParseProgram()
+	if err == nil {
+		t.Fatal("no error")
+	}
+	for _, statement := range program {
+		if _, ok := statement.(*ERROR_STATEMENT); !ok {
+			t.Errorf("parsed %T", statement)
+		}
+	}
+	if len(parser.Errors()) != len(program) {
+		t.Errorf("%d errors for %d statements", len(parser.Errors()), len(program))
+	}
+}
+
+// running a partial AST adds notes and a stack to a copy of the parse
+// error, not to the one of the parser
+func TestRunPartialProgram(t *testing.T) {
+	parser := NewParser("fn f: {\nlet = 1 }\nf()")
+	program, err := parser.ParseProgram()
+	if err == nil {
+		t.Fatal("no parse error")
+	}
+	parseErr := parser.Errors()[0]
+	before := parseErr.Error()
+	for i := 0; i < 2; i++ {
+		err := NewInterpreter().Interpret(context.Background(), program)
+		scriptErr, ok := AsScriptError(err)
+		if !ok || scriptErr == parseErr || len(scriptErr.Stack) == 0 {
+			t.Errorf("run %d failed with %v, want a copy of the parse error with a stack", i, err)
+		}
+	}
+	if after := parseErr.Error(); after != before || parseErr.Stack != nil {
+		t.Errorf("the parse error became %q, was %q", after, before)
+	}
+}
+
+// source that must print output, or fail with the error code if there
+// is one
+type literalTest struct {
+	source string
+	output string
+	code   string
+}
+
+func runLiteralTests(t *testing.T, tests []literalTest) {
+	t.Helper()
+	for _, test := range tests {
+		_, err := NewParser(test.source).ParseProgram()
+		output := ""
+		if err == nil {
+			output, err = runScript(t, test.source)
+		}
+		if test.code != "" {
+			var scriptErr *ScriptError
+			if !errors.As(err, &scriptErr) || scriptErr.Code != test.code {
+				t.Errorf("%q failed with %v, want %s", test.source, err, test.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q failed: %s", test.source, err)
+			continue
+		}
+		if output != test.output+"\n" {
+			t.Errorf("%q printed %q, want %q", test.source, output, test.output)
+		}
+	}
+}
+
+func TestDecimalAndRational(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		{"say 1.50d", "1.50", ""},
+		{"say 0.1d + 0.2d", "0.3", ""},
+		{"say 1.50d + 2.5d", "4.00", ""},
+		// the result has the larger scale of the operands, rounded half
+		// to even
+		{"say 1d / 3d", "0", ""},
+		{"say 1.00d / 3d", "0.33", ""},
+		{"say 2.00d / 3d", "0.67", ""},
+		{"say 0.5d * 0.5d", "0.2", ""},
+		{"say 1d / 0d", "", DIVISION_BY_ZERO_CODE},
+		{"say 1/3r + 1/6r", "1/2", ""},
+		{"say 4/2r", "2", ""},
+		{"say 1/0r", "", INVALID_LITERAL_CODE},
+		// INT -> DECIMAL -> RATIONAL -> FLOAT
+		{"say 1 + 1.5d", "2.5", ""},
+		{"say 1 + 1/2r", "3/2", ""},
+		{"say 2r * 0.5d", "1", ""},
+		{"say 1/2r + 0.5", "1.000000", ""},
+		{"say 1.5 + 1d", "", TYPE_ERROR_CODE},
+	})
+}
+
+func TestNumberLiterals(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		{"say 0xff", "255", ""},
+		{"say 0XFF_FF", "65535", ""},
+		{"say 0o17", "15", ""},
+		{"say 0b101", "5", ""},
+		{"say 1_000_000", "1000000", ""},
+		{"say 1e3", "1000.000000", ""},
+		{"say 2E2", "200.000000", ""},
+		{"say 1.5e-2", "0.015000", ""},
+		{"say .5", "0.500000", ""},
+		{"say 9223372036854775808", "9223372036854775808", ""},
+		{"say 1.2.3", "", MALFORMED_NUMBER_CODE},
+		{"say 0x", "", MALFORMED_NUMBER_CODE},
+		{"say 0b2", "", MALFORMED_NUMBER_CODE},
+		{"say 0o8", "", MALFORMED_NUMBER_CODE},
+		{"say 1__0", "", MALFORMED_NUMBER_CODE},
+		{"say 1_", "", MALFORMED_NUMBER_CODE},
+		{"say 1e", "", MALFORMED_NUMBER_CODE},
+	})
+}
+
+func TestComments(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		{"/* a /* nested */ b */ say 1", "1", ""},
+		{"say 1 /* trailing */", "1", ""},
+		{"say /* inside */ 2", "2", ""},
+		{"say 1 # line", "1", ""},
+		{"/* a /* nested */", "", UNTERMINATED_COMMENT_CODE},
+	})
+
+	program, err := NewParser("## adds one\n## to x\nfn inc: x { return x + 1 }\n# not a doc\nlet y = 1").ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := program[0].(*EXPRESSION_STATEMENT).Expression.(*FUNCTIONAL_EXPRESSION)
+	if fn.Doc != "adds one\nto x" {
+		t.Errorf("doc of inc is %q", fn.Doc)
+	}
+	if let := program[1].(*LET_STATEMENT); let.Doc != "" {
+		t.Errorf("doc of y is %q", let.Doc)
+	}
+}
+
+func TestNewlineTermination(t *testing.T) {
+	runLiteralTests(t, []literalTest{
+		// a trailing operator continues the statement
+		{"let x = 1 +\n2\nsay x", "3", ""},
+		{"let x = 2 *\n\n3\nsay x", "6", ""},
+		// a leading + or - starts a new statement
+		{"let x = 1\n+ 2\nsay x", "1", ""},
+		{"let y = 5\n-3\nsay y", "5", ""},
+		// inside brackets newlines do not end anything
+		{"let z = (1\n+ 2)\nsay z", "3", ""},
+		{"say [1,\n2]", "[1, 2]", ""},
+		{"say 1; say 2", "1\n2", ""},
+		{"say 1 say 2", "", UNEXPECTED_TOKEN_CODE},
+	})
+}
+
+// the text of source a span covers, spans are on one line here
+func spanText(source string, span Span) string {
+	lines := strings.Split(source, "\n")
+	if span.Start.Line < 1 || span.Start.Line > len(lines) || span.End.Line != span.Start.Line {
+		return fmt.Sprintf("<span %v>", span)
+	}
+	line := lines[span.Start.Line-1]
+	if span.Start.Column < 1 || span.End.Column-1 > len(line) || span.End.Column < span.Start.Column {
+		return fmt.Sprintf("<span %v>", span)
+	}
+	return line[span.Start.Column-1 : span.End.Column-1]
+}
+
+func TestExpressionSpans(t *testing.T) {
+	tests := []struct {
+		source string
+		// the expression of the SAY statement, its operands and arguments
+		spans []string
+	}{
+		{"say 1 + 2 * 3", []string{"1 + 2 * 3", "1", "2 * 3"}},
+		{"say -x", []string{"-x", "x"}},
+		{"say f(1, a)", []string{"f(1, a)", "f", "1", "a"}},
+		{"say xs[i + 1]", []string{"xs[i + 1]", "xs", "i + 1"}},
+		{"say [1, \"two\"]", []string{"[1, \"two\"]", "1", "\"two\""}},
+		{"say lambda x: x * 2", []string{"lambda x: x * 2"}},
+	}
+	for _, test := range tests {
+		program, err := NewParser(test.source).ParseProgram()
+		if err != nil {
+			t.Fatalf("parsing %q: %s", test.source, err)
+		}
+		expression := program[0].(*SAY_STATEMENT).Expression
+		nodes := []EXPRESSION_NODE{expression}
+		switch ex := expression.(type) {
+		case *BINARY_EXPRESSION:
+			nodes = append(nodes, ex.Left, ex.Right)
+		case *UNARY_OPERATION_EXPRESSION:
+			nodes = append(nodes, ex.Expression)
+		case *FUNCTION_CALL_EXPRESSION:
+			nodes = append(append(nodes, ex.Callable), ex.Args...)
+		case *INDEX_OPERATOR_EXPRESSION:
+			nodes = append(nodes, ex.Array, ex.Index)
+		case *ARRAY_EXPRESSION:
+			nodes = append(nodes, ex.Expressions...)
+		}
+		spans := []string{}
+		for _, node := range nodes {
+			spans = append(spans, spanText(test.source, node.GetSpan()))
+		}
+		if strings.Join(spans, "|") != strings.Join(test.spans, "|") {
+			t.Errorf("%q has the spans %q, want %q", test.source, spans, test.spans)
+		}
+	}
+}
+
+// a runtime error points at the innermost expression that failed
+func TestRuntimeErrorSpans(t *testing.T) {
+	tests := []struct {
+		source string
+		span   string
+	}{
+		{"let x = 1\nsay 2 + x(3)", "x(3)"},
+		{"say 1 + (2 / 0)", "2 / 0"},
+		{"say [1, 2, missing]", "missing"},
+		{"let xs = [1]\nsay xs[\"a\"] + 1", "xs[\"a\"]"},
+		{"say 1 + -\"a\"", "-\"a\""},
+	}
+	for _, test := range tests {
+		_, err := runScript(t, test.source)
+		scriptErr, ok := AsScriptError(err)
+		if !ok {
+			t.Errorf("%q failed with %v, want a ScriptError", test.source, err)
+			continue
+		}
+		if span := spanText(test.source, Span{scriptErr.Start, scriptErr.End}); span != test.span {
+			t.Errorf("%q failed at %q, want %q", test.source, span, test.span)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Capability names a group of builtins, see RegisterBuiltin
+type Capability string
+
+const (
+	CORE_CAPABILITY    Capability = "core"    // pure functions: len, str, range...
+	IO_CAPABILITY      Capability = "io"      // the interpreter streams: print, input
+	FS_CAPABILITY      Capability = "fs"      // files: read_file, write_file...
+	ENV_CAPABILITY     Capability = "env"     // environment variables
+	PROCESS_CAPABILITY Capability = "process" // running commands
+)
+
+// Policy decides which builtins an interpreter gets. Builtins of capabilities
+// that are not granted still exist, but fail with ErrPermissionDenied.
+// The rest of the fields narrow the granted capabilities down,
+// nil means no restriction
+type Policy struct {
+	Capabilities []Capability
+	// files outside of these roots are not accessible
+	FSRoots []FSRoot
+	// names of environment variables scripts may read and change
+	EnvVars []string
+	// commands scripts may run, either names looked up in PATH or paths
+	Commands []string
+}
+
+type FSRoot struct {
+	Path     string
+	ReadOnly bool
+}
+
+// core and io only, safe for untrusted scripts
+func DefaultPolicy() Policy {
+	return Policy{Capabilities: []Capability{CORE_CAPABILITY, IO_CAPABILITY}}
+}
+
+// every capability without restrictions, what a command-line runner wants
+func AllowAllPolicy() Policy {
+	return Policy{Capabilities: []Capability{
+		CORE_CAPABILITY, IO_CAPABILITY, FS_CAPABILITY, ENV_CAPABILITY, PROCESS_CAPABILITY,
+	}}
+}
+
+func (self Policy) Allows(capability Capability) bool {
+	for _, granted := range self.Capabilities {
+		if granted == capability {
+			return true
+		}
+	}
+	return false
+}
+
+func PermissionError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrPermissionDenied, fmt.Sprintf(format, args...))
+}
+
+func DeniedBuiltin(name string, capability Capability) BUILTIN {
+	return BUILTIN{name, func(*Interpreter, []Object) (Object, error) {
+		return nil, PermissionError("%s requires the \"%s\" capability", name, capability)
+	}}
+}
+
+// replaces the builtins of the interpreter with the ones policy grants,
+// global variables are kept
+func (self *Interpreter) SetPolicy(policy Policy) {
+	self.policy = policy
+	self.globals.prev = MakeBuiltinScope(policy)
+}
+
+func (self *Interpreter) Policy() Policy {
+	return self.policy
+}
+
+// returns the path to use if policy lets scripts access path: the
+// absolute path, or with FSRoots the path with its symlinks resolved
+// that was checked. Callers must open the result and not path, so a
+// symlink changed in between cannot lead out of the roots
+func (self Policy) CheckPath(path string, write bool) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if self.FSRoots == nil {
+		return abs, nil
+	}
+
+	resolved := resolveSymlinks(abs)
+	for _, root := range self.FSRoots {
+		rootAbs, err := filepath.Abs(root.Path)
+		if err != nil {
+			continue
+		}
+		if !isInside(resolveSymlinks(rootAbs), resolved) {
+			continue
+		}
+		if write && root.ReadOnly {
+			return "", PermissionError("%s is read-only", path)
+		}
+		return resolved, nil
+	}
+	return "", PermissionError("%s is outside of the allowed roots", path)
+}
+
+// symlinks must not lead out of a root; for paths that do not exist yet
+// the closest existing parent is resolved, and a dangling symlink is
+// followed to where writing it would create the file
+func resolveSymlinks(path string) string {
+	return resolveSymlinksIn(path, 0)
+}
+
+// links counts the dangling symlinks followed, to stop at loops
+func resolveSymlinksIn(path string, links int) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path
+	}
+	resolvedParent := resolveSymlinksIn(parent, links)
+	if target, err := os.Readlink(path); err == nil && links < MAX_SYMLINKS {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(resolvedParent, target)
+		}
+		return resolveSymlinksIn(target, links+1)
+	}
+	return filepath.Join(resolvedParent, filepath.Base(path))
+}
+
+// dangling symlinks followed before giving up, like the kernel's limit
+const MAX_SYMLINKS = 40
+
+func isInside(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+func (self Policy) CheckEnv(name string) error {
+	if self.EnvVars == nil || Includes(self.EnvVars, name) {
+		return nil
+	}
+	return PermissionError("environment variable %s is not allowed", name)
+}
+
+func (self Policy) CheckCommand(command string) error {
+	if self.Commands == nil || Includes(self.Commands, command) {
+		return nil
+	}
+	return PermissionError("command %s is not allowed", command)
+}
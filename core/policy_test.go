@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runWithPolicy(t *testing.T, interpreter *Interpreter, source string) (string, error) {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatalf("parsing %q: %s", source, err)
+	}
+	var output strings.Builder
+	interpreter.SetStdout(&output)
+	err = interpreter.Interpret(context.Background(), program)
+	return output.String(), err
+}
+
+func TestSetenvStaysInInterpreter(t *testing.T) {
+	const name = "INTERPRETER_TEST_SETENV"
+	os.Unsetenv(name)
+	interpreter := NewInterpreter()
+	interpreter.SetPolicy(AllowAllPolicy())
+	output, err := runWithPolicy(t, interpreter, "setenv(\""+name+"\", \"set\")\nsay getenv(\""+name+"\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "set\n" {
+		t.Errorf("getenv after setenv printed %q", output)
+	}
+	if value, ok := os.LookupEnv(name); ok {
+		t.Errorf("setenv changed the process environment to %q", value)
+	}
+
+	other := NewInterpreter()
+	other.SetPolicy(AllowAllPolicy())
+	output, err = runWithPolicy(t, other, "say getenv(\""+name+"\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "null\n" {
+		t.Errorf("another interpreter sees the variable: %q", output)
+	}
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run")
+	}
+	output, err = runWithPolicy(t, interpreter, "say exec(\"sh\", \"-c\", \"echo $"+name+"\")")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "set\n\n" {
+		t.Errorf("exec saw %q", output)
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, path := range []string{root, outside} {
+		if err := os.Mkdir(path, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip("no symlinks: ", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "file"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "file"), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	policy := Policy{FSRoots: []FSRoot{{Path: root}, {Path: filepath.Join(dir, "readonly"), ReadOnly: true}}}
+
+	tests := []struct {
+		path     string
+		write    bool
+		resolved string
+		denied   bool
+	}{
+		{filepath.Join(root, "file"), true, filepath.Join(root, "file"), false},
+		{filepath.Join(root, "inner"), false, filepath.Join(root, "file"), false},
+		{filepath.Join(root, "new", "file"), true, filepath.Join(root, "new", "file"), false},
+		{filepath.Join(root, "link", "file"), false, "", true},
+		{filepath.Join(outside, "file"), false, "", true},
+		{filepath.Join(root, "escape"), true, "", true},
+		{filepath.Join(dir, "readonly", "file"), false, filepath.Join(dir, "readonly", "file"), false},
+		{filepath.Join(dir, "readonly", "file"), true, "", true},
+	}
+	for _, test := range tests {
+		resolved, err := policy.CheckPath(test.path, test.write)
+		if test.denied {
+			if !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("CheckPath(%s, %t) = %q, %v, want it denied", test.path, test.write, resolved, err)
+			}
+			continue
+		}
+		if err != nil || resolved != test.resolved {
+			t.Errorf("CheckPath(%s, %t) = %q, %v, want %q", test.path, test.write, resolved, err, test.resolved)
+		}
+	}
+}
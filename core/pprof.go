@@ -0,0 +1,183 @@
+package core
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// The profile in the gzipped protobuf format of pprof, see
+// github.com/google/pprof/proto/profile.proto. Every script function is
+// a pprof function, every function and line a location and every call
+// stack a sample with its calls and self time, so `go tool pprof` shows
+// the script frames in its flame graph
+
+// field numbers of profile.proto
+const (
+	PROFILE_SAMPLE_TYPE    = 1
+	PROFILE_SAMPLE         = 2
+	PROFILE_LOCATION       = 4
+	PROFILE_FUNCTION       = 5
+	PROFILE_STRING_TABLE   = 6
+	PROFILE_TIME_NANOS     = 9
+	PROFILE_DURATION_NANOS = 10
+	PROFILE_PERIOD_TYPE    = 11
+	PROFILE_PERIOD         = 12
+
+	VALUE_TYPE_TYPE = 1
+	VALUE_TYPE_UNIT = 2
+
+	SAMPLE_LOCATION_ID = 1
+	SAMPLE_VALUE       = 2
+
+	LOCATION_ID   = 1
+	LOCATION_LINE = 4
+
+	LINE_FUNCTION_ID = 1
+	LINE_LINE        = 2
+
+	FUNCTION_ID          = 1
+	FUNCTION_NAME        = 2
+	FUNCTION_SYSTEM_NAME = 3
+	FUNCTION_FILENAME    = 4
+	FUNCTION_START_LINE  = 5
+)
+
+// a protobuf message being encoded
+type protoBuffer struct {
+	data []byte
+}
+
+func (self *protoBuffer) varint(value uint64) {
+	for value >= 0x80 {
+		self.data = append(self.data, byte(value)|0x80)
+		value >>= 7
+	}
+	self.data = append(self.data, byte(value))
+}
+
+func (self *protoBuffer) key(field, wireType int) {
+	self.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// an int64 or uint64 field, zero values are left out
+func (self *protoBuffer) integer(field int, value int64) {
+	if value == 0 {
+		return
+	}
+	self.key(field, 0)
+	self.varint(uint64(value))
+}
+
+func (self *protoBuffer) bytes(field int, data []byte) {
+	self.key(field, 2)
+	self.varint(uint64(len(data)))
+	self.data = append(self.data, data...)
+}
+
+func (self *protoBuffer) message(field int, message *protoBuffer) {
+	self.bytes(field, message.data)
+}
+
+func (self *protoBuffer) packed(field int, values []int64) {
+	packed := &protoBuffer{}
+	for _, value := range values {
+		packed.varint(uint64(value))
+	}
+	self.bytes(field, packed.data)
+}
+
+// WritePprof writes the profile gzipped, file is the script's name
+func (self *Profiler) WritePprof(w io.Writer, file string) error {
+	profile := &protoBuffer{}
+	indexes := map[string]int64{}
+	table := []string{}
+	intern := func(text string) int64 {
+		if index, ok := indexes[text]; ok {
+			return index
+		}
+		indexes[text] = int64(len(table))
+		table = append(table, text)
+		return int64(len(table) - 1)
+	}
+	// the string table starts with ""
+	intern("")
+
+	valueType := func(field int, kind, unit string) {
+		message := &protoBuffer{}
+		message.integer(VALUE_TYPE_TYPE, intern(kind))
+		message.integer(VALUE_TYPE_UNIT, intern(unit))
+		profile.message(field, message)
+	}
+	valueType(PROFILE_SAMPLE_TYPE, "calls", "count")
+	valueType(PROFILE_SAMPLE_TYPE, "time", "nanoseconds")
+
+	functionIDs := map[*FunctionProfile]int64{}
+	locationIDs := map[[2]int64]int64{}
+	functions, locations := &protoBuffer{}, &protoBuffer{}
+	location := func(function *FunctionProfile, line int) int64 {
+		functionID, ok := functionIDs[function]
+		if !ok {
+			functionID = int64(len(functionIDs) + 1)
+			functionIDs[function] = functionID
+			// pprof strips <...> from names like C++ templates
+			name := function.Name
+			if name == MAIN_FUNCTION {
+				name = "main"
+			}
+			message := &protoBuffer{}
+			message.integer(FUNCTION_ID, functionID)
+			message.integer(FUNCTION_NAME, intern(name))
+			message.integer(FUNCTION_SYSTEM_NAME, intern(name))
+			if function.Line > 0 || function.Name == MAIN_FUNCTION {
+				message.integer(FUNCTION_FILENAME, intern(file))
+			}
+			message.integer(FUNCTION_START_LINE, int64(function.Line))
+			functions.message(PROFILE_FUNCTION, message)
+		}
+		key := [2]int64{functionID, int64(line)}
+		locationID, ok := locationIDs[key]
+		if !ok {
+			locationID = int64(len(locationIDs) + 1)
+			locationIDs[key] = locationID
+			lineMessage := &protoBuffer{}
+			lineMessage.integer(LINE_FUNCTION_ID, functionID)
+			lineMessage.integer(LINE_LINE, int64(line))
+			message := &protoBuffer{}
+			message.integer(LOCATION_ID, locationID)
+			message.message(LOCATION_LINE, lineMessage)
+			locations.message(PROFILE_LOCATION, message)
+		}
+		return locationID
+	}
+
+	for _, sample := range self.Samples() {
+		ids := []int64{}
+		for i, function := range sample.Functions {
+			ids = append(ids, location(function, sample.Lines[i]))
+		}
+		message := &protoBuffer{}
+		message.packed(SAMPLE_LOCATION_ID, ids)
+		message.packed(SAMPLE_VALUE, []int64{int64(sample.Calls), sample.Self.Nanoseconds()})
+		profile.message(PROFILE_SAMPLE, message)
+	}
+	profile.data = append(profile.data, locations.data...)
+	profile.data = append(profile.data, functions.data...)
+
+	// the strings of period_type must be in the table before it is written
+	periodType := &protoBuffer{}
+	periodType.integer(VALUE_TYPE_TYPE, intern("time"))
+	periodType.integer(VALUE_TYPE_UNIT, intern("nanoseconds"))
+	for _, text := range table {
+		profile.bytes(PROFILE_STRING_TABLE, []byte(text))
+	}
+	profile.integer(PROFILE_TIME_NANOS, self.start.UnixNano())
+	profile.integer(PROFILE_DURATION_NANOS, self.Duration.Nanoseconds())
+	profile.message(PROFILE_PERIOD_TYPE, periodType)
+	profile.integer(PROFILE_PERIOD, 1)
+
+	writer := gzip.NewWriter(w)
+	if _, err := writer.Write(profile.data); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Profiler records, while attached to an interpreter, the calls of every
+// function with their total and self time, the hits of every statement
+// and the time spent in each distinct call stack, see WritePprof. Time
+// spent in the profiler itself is not subtracted
+
+const MAIN_FUNCTION = "<main>"
+
+type FunctionProfile struct {
+	Name string
+	// first line of the body, 0 for builtins
+	Line  int
+	Calls int
+	// time of the calls, nested calls of the same function are only
+	// counted once
+	Total time.Duration
+	// Total minus the time spent in other calls
+	Self time.Duration
+}
+
+type StatementProfile struct {
+	Position
+	Hits int
+}
+
+type Profiler struct {
+	functions  map[string]*FunctionProfile
+	statements map[Position]*StatementProfile
+	stack      []*activeCall
+	// self time per call stack, keyed by StackKey
+	samples map[string]*StackSample
+	start   time.Time
+	// the time of the run, set by Stop
+	Duration time.Duration
+}
+
+type activeCall struct {
+	function *FunctionProfile
+	start    time.Time
+	children time.Duration
+	// line of the call in the caller
+	callSite int
+}
+
+// a call stack, the innermost function first, with the line each
+// function is at
+type StackSample struct {
+	Functions []*FunctionProfile
+	Lines     []int
+	Calls     int
+	Self      time.Duration
+}
+
+func NewProfiler() *Profiler {
+	return &Profiler{
+		functions:  make(map[string]*FunctionProfile),
+		statements: make(map[Position]*StatementProfile),
+		samples:    make(map[string]*StackSample),
+	}
+}
+
+// attaches a profiler, nil detaches it
+func (self *Interpreter) SetProfiler(profiler *Profiler) {
+	self.profiler = profiler
+}
+
+// starts timing the top level, the time outside of calls goes to
+// MAIN_FUNCTION
+func (self *Profiler) Start() {
+	self.start = time.Now()
+	self.stack = []*activeCall{{function: self.function(MAIN_FUNCTION, 0), start: self.start}}
+	self.stack[0].function.Calls++
+}
+
+func (self *Profiler) Stop() {
+	if len(self.stack) == 0 {
+		return
+	}
+	for len(self.stack) > 1 {
+		self.exit()
+	}
+	self.exit()
+	self.Duration = time.Since(self.start)
+}
+
+func (self *Profiler) function(name string, line int) *FunctionProfile {
+	key := fmt.Sprintf("%s:%d", name, line)
+	function, ok := self.functions[key]
+	if !ok {
+		function = &FunctionProfile{Name: name, Line: line}
+		self.functions[key] = function
+	}
+	return function
+}
+
+// called by EvalStatementList before each statement
+func (self *Profiler) hit(statement STATEMENT_NODE) {
+	position := statement.GetPosition()
+	profile, ok := self.statements[position]
+	if !ok {
+		profile = &StatementProfile{Position: position}
+		self.statements[position] = profile
+	}
+	profile.Hits++
+}
+
+// called by CallFrame around calls
+func (self *Profiler) enter(name string, fn CALLABLE, callSite Span) {
+	line := 0
+	if function, ok := fn.(FUNCTION); ok && len(function.Body) > 0 {
+		line = function.Body[0].GetPosition().Line
+	}
+	profile := self.function(name, line)
+	profile.Calls++
+	self.stack = append(self.stack, &activeCall{
+		function: profile,
+		start:    time.Now(),
+		callSite: callSite.Start.Line,
+	})
+}
+
+func (self *Profiler) exit() {
+	call := self.stack[len(self.stack)-1]
+	self.stack = self.stack[:len(self.stack)-1]
+	elapsed := time.Since(call.start)
+	if !self.recursive(call.function) {
+		call.function.Total += elapsed
+	}
+	call.function.Self += elapsed - call.children
+	if len(self.stack) > 0 {
+		self.stack[len(self.stack)-1].children += elapsed
+	}
+
+	// the stack of the call, with the line each caller is at
+	functions := []*FunctionProfile{call.function}
+	lines := []int{call.function.Line}
+	callSite := call.callSite
+	for i := len(self.stack) - 1; i >= 0; i-- {
+		functions = append(functions, self.stack[i].function)
+		lines = append(lines, callSite)
+		callSite = self.stack[i].callSite
+	}
+	key := StackKey(functions, lines)
+	sample, ok := self.samples[key]
+	if !ok {
+		sample = &StackSample{Functions: functions, Lines: lines}
+		self.samples[key] = sample
+	}
+	sample.Calls++
+	sample.Self += elapsed - call.children
+}
+
+// checks if function is still active further up the stack
+func (self *Profiler) recursive(function *FunctionProfile) bool {
+	for _, call := range self.stack {
+		if call.function == function {
+			return true
+		}
+	}
+	return false
+}
+
+func StackKey(functions []*FunctionProfile, lines []int) string {
+	var builder strings.Builder
+	for i, function := range functions {
+		fmt.Fprintf(&builder, "%s:%d@%d;", function.Name, function.Line, lines[i])
+	}
+	return builder.String()
+}
+
+// functions by self time, the slowest first
+func (self *Profiler) Functions() []*FunctionProfile {
+	functions := []*FunctionProfile{}
+	for _, function := range self.functions {
+		functions = append(functions, function)
+	}
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Self != functions[j].Self {
+			return functions[i].Self > functions[j].Self
+		}
+		return functions[i].Name < functions[j].Name
+	})
+	return functions
+}
+
+// statements by hits, the most frequent first
+func (self *Profiler) Statements() []*StatementProfile {
+	statements := []*StatementProfile{}
+	for _, statement := range self.statements {
+		statements = append(statements, statement)
+	}
+	sort.Slice(statements, func(i, j int) bool {
+		if statements[i].Hits != statements[j].Hits {
+			return statements[i].Hits > statements[j].Hits
+		}
+		return Before(statements[i].Position, statements[j].Position)
+	})
+	return statements
+}
+
+func (self *Profiler) Samples() []*StackSample {
+	keys := []string{}
+	for key := range self.samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	samples := []*StackSample{}
+	for _, key := range keys {
+		samples = append(samples, self.samples[key])
+	}
+	return samples
+}
+
+// writes the functions and the first lines statements as tables, source
+// is used to show the statements
+func (self *Profiler) WriteTable(w io.Writer, source string, lines int) {
+	fmt.Fprintf(w, "total time %s\n\n", FormatDuration(self.Duration))
+	fmt.Fprintf(w, "%-24s %8s %12s %7s %12s %7s\n", "function", "calls", "total", "total%", "self", "self%")
+	for _, function := range self.Functions() {
+		name := function.Name
+		if function.Line > 0 {
+			name = fmt.Sprintf("%s:%d", name, function.Line)
+		}
+		fmt.Fprintf(w, "%-24s %8d %12s %6.1f%% %12s %6.1f%%\n", name, function.Calls,
+			FormatDuration(function.Total), self.percent(function.Total),
+			FormatDuration(function.Self), self.percent(function.Self))
+	}
+
+	sourceLines := strings.Split(source, "\n")
+	statements := self.Statements()
+	if lines > 0 && len(statements) > lines {
+		statements = statements[:lines]
+	}
+	fmt.Fprintf(w, "\n%-10s %8s  %s\n", "line", "hits", "statement")
+	for _, statement := range statements {
+		text := ""
+		if statement.Line >= 1 && statement.Line <= len(sourceLines) {
+			text = strings.TrimSpace(sourceLines[statement.Line-1])
+		}
+		fmt.Fprintf(w, "%-10s %8d  %s\n",
+			fmt.Sprintf("%d:%d", statement.Line, statement.Column), statement.Hits, text)
+	}
+}
+
+func (self *Profiler) percent(duration time.Duration) float64 {
+	if self.Duration <= 0 {
+		return 0
+	}
+	return 100 * float64(duration) / float64(self.Duration)
+}
+
+// durations with two decimals in a unit that fits, e.g. 1.23ms
+func FormatDuration(duration time.Duration) string {
+	switch {
+	case duration >= time.Second:
+		return fmt.Sprintf("%.2fs", duration.Seconds())
+	case duration >= time.Millisecond:
+		return fmt.Sprintf("%.2fms", float64(duration)/float64(time.Millisecond))
+	case duration >= time.Microsecond:
+		return fmt.Sprintf("%.2fµs", float64(duration)/float64(time.Microsecond))
+	default:
+		return fmt.Sprintf("%dns", duration.Nanoseconds())
+	}
+}
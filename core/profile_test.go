@@ -0,0 +1,100 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func profile(t *testing.T, source string) *Profiler {
+	t.Helper()
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	interpreter := NewInterpreter()
+	interpreter.SetStdout(ioutil.Discard)
+	profiler := NewProfiler()
+	interpreter.SetProfiler(profiler)
+	profiler.Start()
+	err = interpreter.Interpret(context.Background(), program)
+	profiler.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return profiler
+}
+
+func TestProfiler(t *testing.T) {
+	profiler := profile(t, "fn fib: n {\n    if n < 2 { return n }\n    return fib(n - 1) + fib(n - 2)\n}\nlet i = 0\nfor i < 3 {\n    i += 1\n}\nsay fib(10) + len([])")
+
+	calls := map[string]string{}
+	for _, function := range profiler.Functions() {
+		calls[function.Name] = fmt.Sprintf("%d line %d", function.Calls, function.Line)
+		if function.Self > function.Total || function.Total > profiler.Duration {
+			t.Errorf("%s has the self time %s and total %s in %s", function.Name, function.Self, function.Total, profiler.Duration)
+		}
+	}
+	want := map[string]string{"fib": "177 line 2", "len": "1 line 0", MAIN_FUNCTION: "1 line 0"}
+	if fmt.Sprint(calls) != fmt.Sprint(want) {
+		t.Errorf("calls are %v, want %v", calls, want)
+	}
+
+	hits := map[int]int{}
+	for _, statement := range profiler.Statements() {
+		hits[statement.Line] += statement.Hits
+	}
+	// the return of line 2 is only hit for n < 2
+	if got := fmt.Sprint(hits); got != "map[1:1 2:266 3:88 5:1 6:1 7:3 9:1]" {
+		t.Errorf("statement hits are %s", got)
+	}
+
+	// fib called from itself and from the top level are separate stacks
+	stacks := []string{}
+	for _, sample := range profiler.Samples() {
+		names := []string{}
+		for _, function := range sample.Functions {
+			names = append(names, function.Name)
+		}
+		stacks = append(stacks, strings.Join(names, "<"))
+	}
+	if !contains(stacks, "fib<"+MAIN_FUNCTION) || !contains(stacks, "fib<fib<"+MAIN_FUNCTION) {
+		t.Errorf("the stacks are %v", stacks)
+	}
+}
+
+func contains(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWritePprof(t *testing.T) {
+	profiler := profile(t, "fn twice: x { return x * 2 }\nsay twice(2)")
+	var buffer bytes.Buffer
+	if err := profiler.WritePprof(&buffer, "script.txt"); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := gzip.NewReader(&buffer)
+	if err != nil {
+		t.Fatalf("the profile is not gzipped: %s", err)
+	}
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the string table holds the sample types, the function and file
+	// names, the top level is main for pprof
+	for _, str := range []string{"calls", "nanoseconds", "twice", "main", "script.txt"} {
+		if !bytes.Contains(data, []byte(str)) {
+			t.Errorf("the profile has no string %q", str)
+		}
+	}
+}
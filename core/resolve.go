@@ -0,0 +1,438 @@
+package core
+
+import (
+	"strings"
+)
+
+// Static name resolution: which declaration every identifier refers to,
+// with the scopes the interpreter would create. IF and FOR bodies get a
+// scope of their own, a function one holding its parameters and body.
+// The resolver also finds the lint issues that need scopes, see Lint
+
+type SymbolKind string
+
+const (
+	VARIABLE_SYMBOL  SymbolKind = "variable"
+	FUNCTION_SYMBOL  SymbolKind = "function"
+	PARAMETER_SYMBOL SymbolKind = "parameter"
+)
+
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// the identifier in the declaration
+	Span
+	// the whole LET statement, function or parameter
+	Declaration Span
+	Doc         string
+	// parameters of a function
+	Params []string
+	// the other places the name is written, reads and assignments
+	References []Span
+	// the function the symbol is declared in, nil at the top level
+	Parent *Symbol
+
+	// the declaring statement was reached, bindings of a statement list
+	// exist from its start so that early uses are found
+	declared bool
+	used     bool
+	level    int
+}
+
+type SymbolScope struct {
+	// the source the scope covers, the top level scope covers everything
+	Span
+	// in declaration order
+	Symbols  []*Symbol
+	names    map[string]*Symbol
+	Parent   *SymbolScope
+	Children []*SymbolScope
+}
+
+type Resolution struct {
+	// all declarations in source order
+	Symbols []*Symbol
+	Scope   *SymbolScope
+	issues  []LintIssue
+}
+
+// Resolve resolves the names of a parsed program, globals are names
+// defined by the host besides the builtins
+func Resolve(program []STATEMENT_NODE, globals []string) *Resolution {
+	resolver := &resolver{known: make(map[string]bool), resolution: &Resolution{}}
+	for _, group := range Builtins {
+		for name := range group {
+			resolver.known[name] = true
+		}
+	}
+	for _, name := range globals {
+		resolver.known[name] = true
+	}
+
+	resolver.push(Span{})
+	resolver.resolution.Scope = resolver.scope
+	resolver.statements(program)
+	resolver.pop()
+	return resolver.resolution
+}
+
+func Contains(span Span, pos Position) bool {
+	return !Before(pos, span.Start) && !Before(span.End, pos)
+}
+
+// the symbol declared or referenced at pos
+func (self *Resolution) SymbolAt(pos Position) *Symbol {
+	for _, symbol := range self.Symbols {
+		if Contains(symbol.Span, pos) {
+			return symbol
+		}
+		for _, reference := range symbol.References {
+			if Contains(reference, pos) {
+				return symbol
+			}
+		}
+	}
+	return nil
+}
+
+// the innermost scope around pos
+func (self *Resolution) ScopeAt(pos Position) *SymbolScope {
+	scope := self.Scope
+	for {
+		inner := (*SymbolScope)(nil)
+		for _, child := range scope.Children {
+			if Contains(child.Span, pos) {
+				inner = child
+			}
+		}
+		if inner == nil {
+			return scope
+		}
+		scope = inner
+	}
+}
+
+// the symbols a name written at pos could refer to, inner ones hide
+// outer ones of the same name. Functions are visible before their
+// declaration, they may be called from bodies that run later
+func (self *Resolution) Visible(pos Position) []*Symbol {
+	symbols := []*Symbol{}
+	seen := make(map[string]bool)
+	for scope := self.ScopeAt(pos); scope != nil; scope = scope.Parent {
+		for _, symbol := range scope.Symbols {
+			if seen[symbol.Name] {
+				continue
+			}
+			if symbol.Kind == FUNCTION_SYMBOL || Before(symbol.Declaration.Start, pos) {
+				seen[symbol.Name] = true
+				symbols = append(symbols, symbol)
+			}
+		}
+	}
+	return symbols
+}
+
+// the scope symbol is declared in
+func (self *Resolution) ScopeOf(symbol *Symbol) *SymbolScope {
+	scopes := []*SymbolScope{self.Scope}
+	for len(scopes) > 0 {
+		scope := scopes[0]
+		scopes = append(scopes[1:], scope.Children...)
+		if scope.names[symbol.Name] == symbol {
+			return scope
+		}
+	}
+	return nil
+}
+
+// the symbol of that name declared in scope itself
+func (self *SymbolScope) Lookup(name string) *Symbol {
+	return self.names[name]
+}
+
+// RenameConflict returns the symbol that keeps symbol from being renamed
+// to name: one in the same scope, one in a scope around it that the
+// renamed symbol would shadow, or one in a scope inside it that would
+// capture some of its references. Nil if the rename changes no binding
+func (self *Resolution) RenameConflict(symbol *Symbol, name string) *Symbol {
+	home := self.ScopeOf(symbol)
+	if home == nil {
+		return nil
+	}
+	for scope := home; scope != nil; scope = scope.Parent {
+		if other := scope.Lookup(name); other != nil && other != symbol {
+			return other
+		}
+	}
+	for _, reference := range symbol.References {
+		for scope := self.ScopeAt(reference.Start); scope != nil && scope != home; scope = scope.Parent {
+			if other := scope.Lookup(name); other != nil {
+				return other
+			}
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	resolution *Resolution
+	known      map[string]bool
+	scope      *SymbolScope
+	// the named function the walk is in
+	owner *Symbol
+	// number of functions the walk is in
+	level int
+}
+
+func (self *resolver) report(rule string, span Span, format string, args ...interface{}) {
+	self.resolution.issues = append(self.resolution.issues, NewLintIssue(rule, span, format, args...))
+}
+
+func (self *resolver) push(span Span) {
+	scope := &SymbolScope{Span: span, names: make(map[string]*Symbol), Parent: self.scope}
+	if self.scope != nil {
+		self.scope.Children = append(self.scope.Children, scope)
+	}
+	self.scope = scope
+}
+
+// leaves the scope, reporting its unused bindings
+func (self *resolver) pop() {
+	for _, symbol := range self.scope.Symbols {
+		if symbol.used || strings.HasPrefix(symbol.Name, "_") {
+			continue
+		}
+		// the test command calls the tests, see TestFunctions
+		if self.scope.Parent == nil && symbol.Kind == FUNCTION_SYMBOL && strings.HasPrefix(symbol.Name, TEST_PREFIX) {
+			continue
+		}
+		if symbol.Kind == PARAMETER_SYMBOL {
+			self.report(UNUSED_PARAMETER_RULE, symbol.Span, "parameter \"%s\" is never used", symbol.Name)
+		} else {
+			self.report(UNUSED_VARIABLE_RULE, symbol.Span, "%s \"%s\" is never used", symbol.Kind, symbol.Name)
+		}
+	}
+	self.scope = self.scope.Parent
+}
+
+// the symbol name refers to at this point of the walk, the innermost
+// one declared so far. A binding whose declaration comes later in its
+// statement list is only returned if no outer one is declared, so that
+// the use is reported or, in a function body, resolved to it
+func (self *resolver) lookup(name string) *Symbol {
+	return lookupFrom(self.scope, name)
+}
+
+func lookupFrom(scope *SymbolScope, name string) *Symbol {
+	var later *Symbol
+	for ; scope != nil; scope = scope.Parent {
+		symbol, ok := scope.names[name]
+		if !ok {
+			continue
+		}
+		if symbol.declared {
+			return symbol
+		}
+		if later == nil {
+			later = symbol
+		}
+	}
+	return later
+}
+
+// adds a symbol to the current scope, not declared yet
+func (self *resolver) bind(name string, kind SymbolKind, span, declaration Span) *Symbol {
+	if symbol, ok := self.scope.names[name]; ok {
+		return symbol
+	}
+	symbol := &Symbol{
+		Name:        name,
+		Kind:        kind,
+		Span:        span,
+		Declaration: declaration,
+		Parent:      self.owner,
+		level:       self.level,
+	}
+	self.scope.names[name] = symbol
+	self.scope.Symbols = append(self.scope.Symbols, symbol)
+	self.resolution.Symbols = append(self.resolution.Symbols, symbol)
+	return symbol
+}
+
+// marks name as declared, reporting outer symbols it shadows
+func (self *resolver) declare(name string, kind SymbolKind, span, declaration Span) *Symbol {
+	symbol := self.bind(name, kind, span, declaration)
+	if symbol.declared {
+		return symbol
+	}
+	symbol.declared = true
+	// an outer declaration coming later is only shadowed in a function
+	// body, which may run after it
+	if outer := lookupFrom(self.scope.Parent, name); outer != nil && (outer.declared || outer.level < self.level) {
+		self.report(SHADOWED_NAME_RULE, span, "\"%s\" shadows the declaration %s", name, outer.Span.Start.Format())
+	}
+	return symbol
+}
+
+// resolves a use of name that reads and or writes it
+func (self *resolver) use(name string, span Span, read, write bool) {
+	symbol := self.lookup(name)
+	if symbol == nil {
+		if self.known[name] {
+			return
+		}
+		if write {
+			self.report(UNDECLARED_ASSIGNMENT_RULE, span, "assignment to undeclared variable \"%s\"", name)
+		} else {
+			self.report(UNDEFINED_NAME_RULE, span, "\"%s\" is not defined", name)
+		}
+		return
+	}
+	symbol.References = append(symbol.References, span)
+	// a function body may use names declared after the function,
+	// it runs later
+	if !symbol.declared && symbol.level == self.level {
+		self.report(USE_BEFORE_DECLARATION_RULE, span,
+			"\"%s\" is used before its declaration %s", name, symbol.Span.Start.Format())
+	}
+	if read {
+		symbol.used = true
+	}
+}
+
+// a statement list in the current scope
+func (self *resolver) statements(list []STATEMENT_NODE) {
+	for _, statement := range list {
+		switch st := statement.(type) {
+		case *LET_STATEMENT:
+			symbol := self.bind(st.Identifier, VARIABLE_SYMBOL, st.Name, Span{st.Position, st.End})
+			if fn, ok := st.Expression.(*FUNCTIONAL_EXPRESSION); ok {
+				symbol.Kind, symbol.Params = FUNCTION_SYMBOL, fn.Args
+			}
+		case *EXPRESSION_STATEMENT:
+			if fn, ok := st.Expression.(*FUNCTIONAL_EXPRESSION); ok && fn.Identifier != "" {
+				self.bind(fn.Identifier, FUNCTION_SYMBOL, fn.Name, fn.Span).Params = fn.Args
+			}
+		}
+	}
+
+	reachable := true
+	for i, statement := range list {
+		self.statement(statement)
+		if reachable && Terminates(statement) && i+1 < len(list) {
+			reachable = false
+			self.report(UNREACHABLE_CODE_RULE, Span{list[i+1].GetPosition(), list[len(list)-1].GetEnd()},
+				"unreachable code")
+			// the rest is still resolved, as if it could run
+		}
+	}
+}
+
+// a block in a scope of its own, like the interpreter runs IF and FOR bodies
+func (self *resolver) block(list []STATEMENT_NODE, span Span) {
+	self.push(span)
+	self.statements(list)
+	self.pop()
+}
+
+func (self *resolver) statement(statement STATEMENT_NODE) {
+	switch st := statement.(type) {
+	case *RETURN_STATEMENT:
+		self.expression(st.Expression)
+	case *LET_STATEMENT:
+		symbol := self.bind(st.Identifier, VARIABLE_SYMBOL, st.Name, Span{st.Position, st.End})
+		symbol.Doc = st.Doc
+		if fn, ok := st.Expression.(*FUNCTIONAL_EXPRESSION); ok {
+			if symbol.Doc == "" {
+				symbol.Doc = fn.Doc
+			}
+			self.function(fn, symbol)
+		} else if st.Expression != nil {
+			self.expression(st.Expression)
+		}
+		self.declare(st.Identifier, symbol.Kind, st.Name, symbol.Declaration)
+	case *FOR_STATEMENT:
+		self.expression(st.Condition)
+		if value, ok := ConstantCondition(st.Condition); ok {
+			span := Span{st.Position, st.End}
+			if !value {
+				self.report(CONSTANT_CONDITION_RULE, span, "condition is always false, the loop never runs")
+			} else if !Escapes(st.Body) {
+				self.report(CONSTANT_CONDITION_RULE, span,
+					"condition is always true and the body has no break or return, the loop never ends")
+			}
+		}
+		self.block(st.Body, Span{st.Condition.GetSpan().End, st.End})
+	case *IF_STATEMENT:
+		self.expression(st.Condition)
+		if value, ok := ConstantCondition(st.Condition); ok {
+			self.report(CONSTANT_CONDITION_RULE, st.Condition.GetSpan(), "condition is always %t", value)
+		}
+		self.block(st.Then, Span{st.Condition.GetSpan().End, st.ThenEnd})
+		if st.Els != nil {
+			self.block(st.Els, Span{st.ThenEnd, st.End})
+		}
+	case *SAY_STATEMENT:
+		self.expression(st.Expression)
+	case *EXPRESSION_STATEMENT:
+		self.expression(st.Expression)
+	}
+}
+
+func (self *resolver) expression(expression EXPRESSION_NODE) {
+	switch ex := expression.(type) {
+	case *VARIABLE_EXPRESSION:
+		self.use(ex.Identifier, ex.Span, true, false)
+	case *BINARY_ASSIGN_EXPRESSION:
+		self.expression(ex.Right)
+		// x += 1 reads x first
+		self.use(ex.Left, ex.Name, ex.Operator != "=", true)
+	case *BINARY_EXPRESSION:
+		self.expression(ex.Left)
+		self.expression(ex.Right)
+	case *UNARY_OPERATION_EXPRESSION:
+		self.expression(ex.Expression)
+	case *FUNCTION_CALL_EXPRESSION:
+		self.expression(ex.Callable)
+		for _, arg := range ex.Args {
+			self.expression(arg)
+		}
+	case *INDEX_OPERATOR_EXPRESSION:
+		self.expression(ex.Array)
+		self.expression(ex.Index)
+	case *ARRAY_EXPRESSION:
+		for _, element := range ex.Expressions {
+			self.expression(element)
+		}
+	case *FUNCTIONAL_EXPRESSION:
+		var symbol *Symbol
+		if ex.Identifier != "" {
+			// "fn name:" binds the name where it is evaluated
+			symbol = self.declare(ex.Identifier, FUNCTION_SYMBOL, ex.Name, ex.Span)
+			symbol.Params, symbol.Doc = ex.Args, ex.Doc
+		}
+		self.function(ex, symbol)
+	}
+}
+
+// the parameters and body of a function, symbol is the name it is
+// declared with if any
+func (self *resolver) function(ex *FUNCTIONAL_EXPRESSION, symbol *Symbol) {
+	outer := self.owner
+	if symbol != nil {
+		self.owner = symbol
+	}
+	self.level++
+	self.push(ex.Span)
+	for i, arg := range ex.Args {
+		span := ex.Span
+		if i < len(ex.Params) {
+			span = ex.Params[i]
+		}
+		self.declare(arg, PARAMETER_SYMBOL, span, span)
+	}
+	self.statements(ex.Body)
+	self.pop()
+	self.level--
+	self.owner = outer
+}
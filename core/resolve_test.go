@@ -0,0 +1,49 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestRenameConflict(t *testing.T) {
+	tests := []struct {
+		source string
+		// the symbol renamed, at its declaration
+		symbol Position
+		name   string
+		// the declaration of the symbol in the way, zero if there is none
+		conflict Position
+	}{
+		{"let x = 1\nsay x", Position{1, 5}, "y", Position{}},
+		{"let x = 1\nlet y = 2\nsay x + y", Position{1, 5}, "y", Position{2, 5}},
+		// the renamed symbol would shadow an outer one
+		{"let y = 1\nif y > 0 { let x = 2\nsay x }", Position{2, 16}, "y", Position{1, 5}},
+		{"let y = 1\nfn f: x { return x }\nsay f(y)", Position{2, 7}, "y", Position{1, 5}},
+		// an inner symbol would capture a reference
+		{"let x = 1\nif x > 0 { let y = 2\nsay x + y }", Position{1, 5}, "y", Position{2, 16}},
+		{"let x = 1\nfn f: y { return x + y }\nsay f(2)", Position{1, 5}, "y", Position{2, 7}},
+		// an inner symbol without references of the renamed one in its scope
+		{"let x = 1\nif true { let y = 2\nsay y }\nsay x", Position{1, 5}, "y", Position{}},
+		// scopes next to each other do not clash
+		{"if true { let x = 1\nsay x }\nif true { let y = 2\nsay y }", Position{1, 15}, "y", Position{}},
+	}
+	for _, test := range tests {
+		program, err := NewParser(test.source).ParseProgram()
+		if err != nil {
+			t.Fatalf("parsing %q: %s", test.source, err)
+		}
+		resolution := Resolve(program, nil)
+		symbol := resolution.SymbolAt(test.symbol)
+		if symbol == nil {
+			t.Errorf("%q has no symbol %s", test.source, test.symbol.Format())
+			continue
+		}
+		conflict := resolution.RenameConflict(symbol, test.name)
+		switch {
+		case test.conflict == Position{} && conflict != nil:
+			t.Errorf("renaming %s to %s in %q clashes with %s", symbol.Name, test.name, test.source, conflict.Span.Start.Format())
+		case test.conflict != Position{} && (conflict == nil || conflict.Span.Start != test.conflict):
+			t.Errorf("renaming %s to %s in %q clashes with %v, want the declaration %s",
+				symbol.Name, test.name, test.source, conflict, test.conflict.Format())
+		}
+	}
+}
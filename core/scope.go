@@ -1,51 +1,65 @@
 package core
 
-import (
-	"errors"
-	"fmt"
-)
-
 type Scope struct {
 	current map[string]Object
 	prev    *Scope
 }
 
-func MakeScope() *Scope {
-	return &Scope{
+// creates the global scope, its parent holds the builtins granted by
+// policy, so scripts are free to shadow them
+func MakeScope(policy Policy) *Scope {
+	return MakeBuiltinScope(policy).NewChild()
+}
+
+// builtins of capabilities the policy denies are replaced with stubs
+// failing with ErrPermissionDenied
+func MakeBuiltinScope(policy Policy) *Scope {
+	builtins := &Scope{
 		current: make(map[string]Object),
 		prev:    nil,
 	}
+	for capability, group := range Builtins {
+		for name, builtin := range group {
+			if policy.Allows(capability) {
+				builtins.current[name] = builtin
+			} else {
+				builtins.current[name] = DeniedBuiltin(name, capability)
+			}
+		}
+	}
+	return builtins
 }
 
 func (self *Scope) Init(identifier string, value Object) error {
 	if _, ok := self.current[identifier]; ok {
-		return errors.New(fmt.Sprintf("trying to initialize \"%s\" for the second time", identifier))
+		return RuntimeError(REDEFINITION_CODE, "trying to initialize \"%s\" for the second time", identifier)
 	}
 	self.current[identifier] = value
 	return nil
 }
 
+// binds identifier in this scope, replacing any previous value
+func (self *Scope) Define(identifier string, value Object) {
+	self.current[identifier] = value
+}
+
 func (self *Scope) Set(identifier string, value Object) (Object, error) {
-	if self.current[identifier] != nil {
-		fmt.Println("Not Nil :)")
-		fmt.Printf("last val: %s", self.current[identifier].ToString())
-		self.current[identifier] = value
-		return value, nil
+	for scope := self; scope != nil; scope = scope.prev {
+		if scope.current[identifier] != nil {
+			scope.current[identifier] = value
+			return value, nil
+		}
 	}
-	if self.prev != nil {
-		return self.prev.Set(identifier, value)
-	}
-	return nil, errors.New(fmt.Sprintf("trying to set uninitialized variable \"%s\"", identifier))
+	return nil, self.Undefined("trying to set uninitialized variable \"%s\"", identifier)
 }
 
 func (self *Scope) Get(identifier string) (Object, error) {
-	if value, ok := self.current[identifier]; ok {
-		return value, nil
-	}
-	if self.prev != nil {
-		return self.prev.Get(identifier)
+	for scope := self; scope != nil; scope = scope.prev {
+		if value, ok := scope.current[identifier]; ok {
+			return value, nil
+		}
 	}
-	return nil, errors.New(fmt.Sprintf("trying to get uninitialized variable \"%s\"", identifier))
+	return nil, self.Undefined("trying to get uninitialized variable \"%s\"", identifier)
 }
 
 func (self *Scope) NewChild() *Scope {
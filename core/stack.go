@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Frame is one active call, CallSite is the span of the call expression
+type Frame struct {
+	Function string
+	CallSite Span
+}
+
+func (self Frame) Format() string {
+	return fmt.Sprintf("in %s, called %s", self.Function, self.CallSite.Start.Format())
+}
+
+// traces longer than this only show the frames at both ends
+const MAX_TRACE_FRAMES = 20
+
+func init() {
+	RegisterBuiltin(CORE_CAPABILITY, "stack", builtinStack)
+}
+
+// the active calls, the most recent one first
+func (self *Interpreter) Stack() []Frame {
+	stack := make([]Frame, len(self.frames))
+	for i, frame := range self.frames {
+		stack[len(stack)-1-i] = frame
+	}
+	return stack
+}
+
+// calls fn with a frame for the call expression ex, errors leaving the
+// frame get the stack at that point unless a deeper call already set one
+func (self *Interpreter) CallFrame(
+	ex *FUNCTION_CALL_EXPRESSION,
+	fn CALLABLE,
+	args []Object,
+) (Object, error) {
+	self.frames = append(self.frames, Frame{CallableName(fn, ex.Callable), ex.Span})
+	self.callers = append(self.callers, self.scope)
+	if self.profiler != nil {
+		self.profiler.enter(self.frames[len(self.frames)-1].Function, fn, ex.Span)
+	}
+	obj, err := fn.Call(self, args)
+	if self.profiler != nil {
+		self.profiler.exit()
+	}
+	if err != nil {
+		scriptErr := ToScriptError(RUNTIME_ERROR, err)
+		if scriptErr.Stack == nil {
+			scriptErr.Stack = self.Stack()
+		}
+		err = scriptErr
+	}
+	self.frames = self.frames[:len(self.frames)-1]
+	self.callers = self.callers[:len(self.callers)-1]
+	return obj, err
+}
+
+// name of the called function: its own, the variable it is called
+// through or "<anonymous>"
+func CallableName(fn CALLABLE, callable EXPRESSION_NODE) string {
+	switch t := fn.(type) {
+	case FUNCTION:
+		if t.Name != "" {
+			return t.Name
+		}
+	case BUILTIN:
+		return t.Name
+	}
+	if variable, ok := callable.(*VARIABLE_EXPRESSION); ok {
+		return variable.Identifier
+	}
+	return "<anonymous>"
+}
+
+// "stack trace (most recent call first):" followed by a line per frame
+func FormatStack(stack []Frame) string {
+	var builder strings.Builder
+	builder.WriteString("stack trace (most recent call first):")
+	for i, frame := range stack {
+		if len(stack) > MAX_TRACE_FRAMES && i == MAX_TRACE_FRAMES/2 {
+			fmt.Fprintf(&builder, "\n    ... %d more frames", len(stack)-MAX_TRACE_FRAMES)
+		}
+		if len(stack) > MAX_TRACE_FRAMES && i >= MAX_TRACE_FRAMES/2 && i < len(stack)-MAX_TRACE_FRAMES/2 {
+			continue
+		}
+		builder.WriteString("\n    ")
+		builder.WriteString(frame.Format())
+	}
+	return builder.String()
+}
+
+// stack() returns the active calls as an ARRAY of MAPs with "function",
+// "line" and "column" keys, the caller of stack() first
+func builtinStack(interpreter *Interpreter, args []Object) (Object, error) {
+	if err := CheckArgs("stack", args, 0, 0); err != nil {
+		return nil, err
+	}
+	// leave out the frame of stack() itself
+	stack := interpreter.Stack()
+	if len(stack) > 0 {
+		stack = stack[1:]
+	}
+	size := ArraySize(len(stack)) + len(stack)*(MAP_SIZE+3*MAP_ENTRY_SIZE)
+	if err := interpreter.Allocate(size); err != nil {
+		return nil, err
+	}
+	result := make(ARRAY, len(stack))
+	for i, frame := range stack {
+		result[i] = MAP{
+			"function": STRING(frame.Function),
+			"line":     INT(frame.CallSite.Start.Line),
+			"column":   INT(frame.CallSite.Start.Column),
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStackTrace(t *testing.T) {
+	source := "fn inner: x { return x / 0 }\nfn outer: { return inner(1) }\nlet f = lambda: outer()\nsay f()"
+	_, err := runScript(t, source)
+	scriptErr, ok := AsScriptError(err)
+	if !ok {
+		t.Fatalf("failed with %v, want a ScriptError", err)
+	}
+	frames := []string{}
+	for _, frame := range scriptErr.Stack {
+		frames = append(frames, fmt.Sprintf("%s %d:%d", frame.Function, frame.CallSite.Start.Line, frame.CallSite.Start.Column))
+	}
+	// anonymous functions are named after their variable
+	want := "inner 2:20, outer 3:17, f 4:5"
+	if strings.Join(frames, ", ") != want {
+		t.Errorf("stack is %v, want %s", frames, want)
+	}
+	if !strings.Contains(err.Error(), "stack trace (most recent call first):\n    in inner, called at line 2, column 20") {
+		t.Errorf("the error does not show the stack:\n%s", err)
+	}
+}
+
+func TestStackBuiltin(t *testing.T) {
+	source := "fn inner: { return stack() }\nfn outer: { return inner() }\n" +
+		"let frames = outer()\nsay len(frames)\nsay frames[0][\"function\"] + \" \" + str(frames[0][\"line\"])\n" +
+		"say frames[1][\"function\"] + \" \" + str(frames[1][\"column\"])\nsay len(stack())"
+	output, err := runScript(t, source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "2\ninner 2\nouter 14\n0\n"; output != want {
+		t.Errorf("printed %q, want %q", output, want)
+	}
+}
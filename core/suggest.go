@@ -0,0 +1,171 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// at most this many names are suggested for an undefined one
+const MAX_SUGGESTIONS = 3
+
+// number of single character insertions, deletions, substitutions and
+// swaps of adjacent characters turning a into b, each character edited
+// once at most (optimal string alignment distance)
+func EditDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	// rows i-2, i-1 and i of the distances between prefixes
+	before := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minOf(prev[j]+1, minOf(curr[j-1]+1, prev[j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = minOf(curr[j], before[j-2]+1)
+			}
+		}
+		before, prev, curr = prev, curr, before
+	}
+	return prev[len(rb)]
+}
+
+func minOf(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// candidates close enough to name to be a typo of it, the closest first.
+// Short names allow one edit, longer ones one edit per three characters
+func Suggest(name string, candidates []string) []string {
+	limit := len([]rune(name)) / 3
+	if limit < 1 {
+		limit = 1
+	}
+	distances := make(map[string]int)
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		// a different case is the most likely typo of all
+		if strings.EqualFold(candidate, name) {
+			distances[candidate] = 0
+			continue
+		}
+		if distance := EditDistance(name, candidate); distance <= limit {
+			distances[candidate] = distance
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for candidate := range distances {
+		suggestions = append(suggestions, candidate)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		di, dj := distances[suggestions[i]], distances[suggestions[j]]
+		if di != dj {
+			return di < dj
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > MAX_SUGGESTIONS {
+		suggestions = suggestions[:MAX_SUGGESTIONS]
+	}
+	return suggestions
+}
+
+// `did you mean "a", "b" or "c"?`, empty without suggestions
+func DidYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		quoted[i] = fmt.Sprintf("\"%s\"", suggestion)
+	}
+	if len(quoted) == 1 {
+		return fmt.Sprintf("did you mean %s?", quoted[0])
+	}
+	return fmt.Sprintf("did you mean %s or %s?",
+		strings.Join(quoted[:len(quoted)-1], ", "), quoted[len(quoted)-1])
+}
+
+// the error for a name the scope chain does not define, with the
+// closest visible names and keywords as help
+func (self *Scope) Undefined(format string, identifier string) *ScriptError {
+	err := RuntimeError(UNDEFINED_VARIABLE_CODE, format, identifier)
+	err.Help = DidYouMean(Suggest(identifier, append(self.Names(), KEYWORDS...)))
+	return err
+}
+
+// names visible from this scope, builtins included
+func (self *Scope) Names() []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for scope := self; scope != nil; scope = scope.prev {
+		for name := range scope.current {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// a statement list being evaluated and the statement it is at
+type activeBlock struct {
+	statements []STATEMENT_NODE
+	index      int
+	// marks where a function call starts, the blocks before it are the
+	// caller's and do not enclose the function body
+	call bool
+}
+
+// turns the undefined name error of identifier into a use-before-LET
+// error if one of the statement lists enclosing the failed statement
+// declares it later. Only the lists of the innermost call are looked at
+func (self *Interpreter) ExplainUndefined(identifier string, err error) error {
+	scriptErr, ok := err.(*ScriptError)
+	if !ok || scriptErr.Code != UNDEFINED_VARIABLE_CODE {
+		return err
+	}
+	for i := len(self.blocks) - 1; i >= 0; i-- {
+		block := self.blocks[i]
+		if block.call {
+			break
+		}
+		for _, statement := range block.statements[block.index+1:] {
+			if Declares(statement, identifier) {
+				scriptErr.Message = fmt.Sprintf("variable \"%s\" is used before its declaration %s",
+					identifier, statement.GetPosition().Format())
+				scriptErr.Help = "move the declaration before the first use"
+				return scriptErr
+			}
+		}
+	}
+	return scriptErr
+}
+
+// checks if statement binds identifier in the scope it runs in
+func Declares(statement STATEMENT_NODE, identifier string) bool {
+	switch st := statement.(type) {
+	case *LET_STATEMENT:
+		return st.Identifier == identifier
+	case *EXPRESSION_STATEMENT:
+		fn, ok := st.Expression.(*FUNCTIONAL_EXPRESSION)
+		return ok && fn.Identifier == identifier
+	default:
+		return false
+	}
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"count", "count", 0},
+		{"", "abc", 3},
+		{"count", "cont", 1},
+		{"count", "coint", 1},
+		{"count", "counts", 1},
+		// a swap of adjacent characters is one edit
+		{"count", "coutn", 1},
+		{"count", "ocunt", 1},
+		{"ab", "ba", 1},
+		// each character is edited once at most
+		{"ca", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"länge", "lnäge", 1},
+	}
+	for _, test := range tests {
+		if distance := EditDistance(test.a, test.b); distance != test.distance {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", test.a, test.b, distance, test.distance)
+		}
+		if distance := EditDistance(test.b, test.a); distance != test.distance {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", test.b, test.a, distance, test.distance)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	candidates := []string{"count", "counter", "print", "Print", "len", "let", "say"}
+	tests := []struct {
+		name        string
+		suggestions string
+	}{
+		{"coutn", "count"},
+		{"cuont", "count"},
+		{"prnit", "print"},
+		{"PRINT", "Print print"},
+		{"lne", "len"},
+		{"coutner", "counter"},
+		{"sya", "say"},
+		{"count", ""},
+		{"xyz", ""},
+	}
+	for _, test := range tests {
+		suggestions := strings.Join(Suggest(test.name, candidates), " ")
+		if suggestions != test.suggestions {
+			t.Errorf("Suggest(%q) = %q, want %q", test.name, suggestions, test.suggestions)
+		}
+	}
+}
+
+func TestExplainUndefined(t *testing.T) {
+	tests := []struct {
+		source  string
+		message string
+		help    string
+	}{
+		{"say x\nlet x = 1", "variable \"x\" is used before its declaration at line 2, column 1", "move the declaration before the first use"},
+		{"if true { say x }\nlet x = 1", "variable \"x\" is used before its declaration at line 2, column 1", "move the declaration before the first use"},
+		{"x = 1\nlet x = 2", "variable \"x\" is used before its declaration at line 2, column 1", "move the declaration before the first use"},
+		{"let count = 1\nsay coutn", "trying to get uninitialized variable \"coutn\"", "did you mean \"count\"?"},
+		// the caller declaring the name later does not matter to f
+		{"fn f: { say y }\nfn g: { f()\nlet y = 1 }\ng()", "trying to get uninitialized variable \"y\"", "did you mean \"f\" or \"g\"?"},
+		{"fn f: { say y }\nf()\nlet y = 1", "trying to get uninitialized variable \"y\"", "did you mean \"f\"?"},
+	}
+	for _, test := range tests {
+		_, err := runScript(t, test.source)
+		scriptErr, ok := err.(*ScriptError)
+		if !ok {
+			t.Errorf("%q failed with %v", test.source, err)
+			continue
+		}
+		if scriptErr.Code != UNDEFINED_VARIABLE_CODE || scriptErr.Message != test.message || scriptErr.Help != test.help {
+			t.Errorf("%q failed with %s %q, help %q, want %q, help %q",
+				test.source, scriptErr.Code, scriptErr.Message, scriptErr.Help, test.message, test.help)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"context"
+	"strings"
+)
+
+// A test script declares its tests as functions named test_... without
+// parameters at the top level, with fn or with LET. Each test runs the
+// whole script first, so the top level should only declare helpers, and
+// then calls its function. Assertions fail it, see assert.go
+
+const TEST_PREFIX = "test_"
+
+type TestFunction struct {
+	Name string
+	Position
+}
+
+// the tests of program in source order
+func TestFunctions(program []STATEMENT_NODE) []TestFunction {
+	tests := []TestFunction{}
+	for _, statement := range program {
+		name := ""
+		var function *FUNCTIONAL_EXPRESSION
+		switch st := statement.(type) {
+		case *EXPRESSION_STATEMENT:
+			function, _ = st.Expression.(*FUNCTIONAL_EXPRESSION)
+			if function != nil {
+				name = function.Identifier
+			}
+		case *LET_STATEMENT:
+			function, _ = st.Expression.(*FUNCTIONAL_EXPRESSION)
+			name = st.Identifier
+		}
+		if function != nil && len(function.Args) == 0 && strings.HasPrefix(name, TEST_PREFIX) {
+			tests = append(tests, TestFunction{name, statement.GetPosition()})
+		}
+	}
+	return tests
+}
+
+// runs program and then the test function name, an interpreter should
+// only run one test so the tests do not share globals
+func (self *Interpreter) RunTest(ctx context.Context, program []STATEMENT_NODE, name string) error {
+	if err := self.Interpret(ctx, program); err != nil {
+		return err
+	}
+	fn, err := self.GetGlobal(name)
+	if err != nil {
+		return err
+	}
+	_, err = self.CallContext(ctx, fn)
+	return err
+}
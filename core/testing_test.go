@@ -0,0 +1,41 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTestFunctions(t *testing.T) {
+	source := `fn test_a: {}
+let test_b = fn: { assert(true) }
+fn helper: {}
+fn test_params: x {}
+let test_value = 1
+if true {
+    fn test_nested: {}
+}
+fn test_c: { fail() }
+`
+	program, err := NewParser(source).ParseProgram()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := TestFunctions(program)
+	want := []TestFunction{{"test_a", Position{1, 1}}, {"test_b", Position{2, 1}}, {"test_c", Position{9, 1}}}
+	if len(tests) != len(want) {
+		t.Fatalf("found %v, want %v", tests, want)
+	}
+	for i := range want {
+		if tests[i] != want[i] {
+			t.Errorf("test %d is %v, want %v", i, tests[i], want[i])
+		}
+	}
+
+	for _, test := range tests {
+		err := NewInterpreter().RunTest(context.Background(), program, test.Name)
+		if failed := errors.Is(err, ErrAssertion); failed != (test.Name == "test_c") {
+			t.Errorf("%s returned %v", test.Name, err)
+		}
+	}
+}
@@ -10,6 +10,8 @@ const (
 	// primitive types
 	INT_TOKEN TokenType = iota
 	FLOAT_TOKEN
+	DECIMAL_TOKEN
+	RATIONAL_TOKEN
 	STRING_TOKEN
 	BOOL_TOKEN
 	NULL_TOKEN
@@ -31,12 +33,16 @@ func (self TokenType) Format() string {
 		return "INT"
 	case FLOAT_TOKEN:
 		return "FLOAT"
+	case DECIMAL_TOKEN:
+		return "DECIMAL"
+	case RATIONAL_TOKEN:
+		return "RATIONAL"
 	case STRING_TOKEN:
 		return "STRING"
 	case BOOL_TOKEN:
 		return "BOOL"
 	case ID_TOKEN:
-		return "INDENTIFIER"
+		return "IDENTIFIER"
 	case KEYWORD_TOKEN:
 		return "KEYWORD"
 	case PUNC_TOKEN:
@@ -59,9 +65,51 @@ type Token struct {
 	Literal string
 	Line    int
 	Column  int
+	// position right after the token
+	EndLine   int
+	EndColumn int
+	// reason and error code of an ILLEGAL_TOKEN
+	Error     string
+	ErrorCode string
+	// text of the "##" doc comment right before the token
+	Doc string
+	// the token is the first one on its line
+	NewlineBefore bool
 }
 
 func (self *Token) Format() string {
 	return fmt.Sprintf("\"%s\" of type %s: (%d, %d)",
 		self.Literal, self.Type.Format(), self.Line, self.Column)
 }
+
+// Comment is kept as trivia for tools like the formatter, Text
+// includes the "#", "##" or "/* */" markers
+type Comment struct {
+	Text       string
+	Start, End Position
+	// code comes before the comment on its line
+	Trailing bool
+}
+
+func (self *Token) Span() Span {
+	return Span{Position{self.Line, self.Column}, Position{self.EndLine, self.EndColumn}}
+}
+
+// short description for error messages, e.g. PUNC "}" or end of input
+func (self *Token) Describe() string {
+	if self.Type == EOF_TOKEN {
+		return "end of input"
+	}
+	return fmt.Sprintf("%s \"%s\"", self.Type.Format(), self.Literal)
+}
+
+// literal of punctuation, operators and keywords, empty for other tokens,
+// so a string literal like "{" is never mistaken for punctuation
+func (self *Token) Symbol() string {
+	switch self.Type {
+	case PUNC_TOKEN, OP_TOKEN, KEYWORD_TOKEN:
+		return self.Literal
+	default:
+		return ""
+	}
+}